@@ -0,0 +1,225 @@
+package logsystem
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize          = 100
+	defaultBatchFlushInterval = time.Second
+	defaultBatchMaxRetries    = 3
+	defaultBatchRetryBackoff  = 500 * time.Millisecond
+	defaultBatchMaxPending    = 10000
+)
+
+// batchConfig is embedded in the config of the drivers sending records in batches
+type batchConfig struct {
+	MaxBatchSize    int `json:"maxBatchSize"`    // records per request; default 100
+	FlushIntervalMs int `json:"flushIntervalMs"` // maximum time a record waits to be sent; default 1000
+	MaxRetries      int `json:"maxRetries"`      // retries of a failed batch; default 3, negative disables retries
+	RetryBackoffMs  int `json:"retryBackoffMs"`  // initial backoff, doubled for each retry; default 500
+	MaxPending      int `json:"maxPending"`      // records kept while the sink is slow, the oldest are dropped; default 10000
+}
+
+func (c batchConfig) withDefaults() batchConfig {
+	if c.MaxBatchSize <= 0 {
+		c.MaxBatchSize = defaultBatchSize
+	}
+	if c.FlushIntervalMs <= 0 {
+		c.FlushIntervalMs = int(defaultBatchFlushInterval / time.Millisecond)
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	} else if c.MaxRetries == 0 {
+		c.MaxRetries = defaultBatchMaxRetries
+	}
+	if c.RetryBackoffMs <= 0 {
+		c.RetryBackoffMs = int(defaultBatchRetryBackoff / time.Millisecond)
+	}
+	if c.MaxPending <= 0 {
+		c.MaxPending = defaultBatchMaxPending
+	}
+	return c
+}
+
+// permanentError marks a send failure that retrying won't fix, e.g. a rejected payload
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// batchSendFunc sends one batch. It may return a shorter batch with the items to retry, which
+// allows partial failures; a nil retry slice with an error retries the whole batch
+type batchSendFunc[T any] func(batch []T) (retry []T, err error)
+
+// batcher collects items and sends them in batches from a background goroutine, when a batch is
+// full or the flush interval elapsed. Failed batches are retried with exponential backoff
+type batcher[T any] struct {
+	config   batchConfig
+	name     string
+	send     batchSendFunc[T]
+	reporter *errorReporter
+
+	mutex   sync.Mutex
+	pending []T
+	dropped int
+	stopped bool
+
+	// serializes the sending of batches between the background goroutine and flush
+	sendMutex sync.Mutex
+
+	wakeup   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// newBatcher reports the records dropped and the batches failed to the reporter of the driver
+func newBatcher[T any](name string, config batchConfig, send batchSendFunc[T], reporter *errorReporter) *batcher[T] {
+	b := &batcher[T]{
+		config:   config.withDefaults(),
+		name:     name,
+		send:     send,
+		reporter: reporter,
+		wakeup:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+// add queues the item; after stop the item is dropped and reported
+func (b *batcher[T]) add(item T) {
+	b.mutex.Lock()
+	if b.stopped {
+		b.mutex.Unlock()
+		b.reporter.reportError(fmt.Errorf("%s: record dropped, the driver is stopped", b.name))
+		return
+	}
+	if len(b.pending) >= b.config.MaxPending {
+		b.pending = b.pending[1:]
+		b.dropped++
+	}
+	b.pending = append(b.pending, item)
+	full := len(b.pending) >= b.config.MaxBatchSize
+	b.mutex.Unlock()
+
+	if full {
+		select {
+		case b.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush sends all pending items before returning
+func (b *batcher[T]) flush() {
+	b.sendMutex.Lock()
+	defer b.sendMutex.Unlock()
+	for b.sendNext() {
+	}
+}
+
+// stop ends the background goroutine and sends the pending items; later calls do nothing
+func (b *batcher[T]) stop() {
+	b.stopOnce.Do(func() {
+		close(b.done)
+		b.wg.Wait()
+		b.flush()
+		b.mutex.Lock()
+		b.stopped = true
+		b.mutex.Unlock()
+		// The items added during the flush
+		b.flush()
+	})
+}
+
+func (b *batcher[T]) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(b.config.FlushIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.flush()
+		case <-b.wakeup:
+			b.sendMutex.Lock()
+			// Only full batches; the ticker takes care of the rest
+			for b.pendingCount() >= b.config.MaxBatchSize && b.sendNext() {
+			}
+			b.sendMutex.Unlock()
+		}
+	}
+}
+
+func (b *batcher[T]) pendingCount() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.pending)
+}
+
+// sendNext sends up to one batch; returns false when there was nothing to send
+func (b *batcher[T]) sendNext() bool {
+	b.mutex.Lock()
+	n := min(len(b.pending), b.config.MaxBatchSize)
+	batch := append([]T{}, b.pending[:n]...)
+	b.pending = b.pending[n:]
+	dropped := b.dropped
+	b.dropped = 0
+	b.mutex.Unlock()
+
+	if dropped > 0 {
+		b.reporter.reportError(fmt.Errorf("%s: dropped %d records, the sink is not keeping up", b.name, dropped))
+	}
+	if n == 0 {
+		return false
+	}
+
+	err := b.sendWithRetry(batch)
+	if err != nil {
+		b.reporter.reportError(fmt.Errorf("%s: failed to send %d records: %w", b.name, len(batch), err))
+	}
+	return true
+}
+
+func (b *batcher[T]) sendWithRetry(batch []T) error {
+	backoff := time.Duration(b.config.RetryBackoffMs) * time.Millisecond
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry []T
+		retry, err = b.send(batch)
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= b.config.MaxRetries {
+			return err
+		}
+		if retry != nil {
+			batch = retry
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-b.done:
+			// Stopping; make a last attempt without waiting
+		}
+		backoff *= 2
+	}
+}
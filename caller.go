@@ -0,0 +1,74 @@
+package logsystem
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Number of frames between the public Logger/TxLogger API and the capture helpers:
+// callerParams/stackTrace <- Logger.logAttrib <- (Logger.logBasic | TxLogger.logAttrib) <- public API
+const callerSkip = 4
+
+const maxStackDepth = 64
+
+// callerParams returns the file, line and function of the frame skip levels above the caller
+func callerParams(skip int) map[Param]string {
+	pc, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return nil
+	}
+	params := map[Param]string{
+		FileParam: file,
+		LineParam: strconv.Itoa(line),
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		params[FunctionParam] = fn.Name()
+	}
+	return params
+}
+
+// stackTrace formats the call stack starting skip levels above the caller, one "function\n\tfile:line" entry per frame
+func stackTrace(skip int) string {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+1, pcs)
+	return formatFrames(pcs[:n], "")
+}
+
+// panicStackTrace formats the call stack of a deferred function recovering a panic, starting at
+// the function that panicked whatever the number of frames between the panic and the caller
+func panicStackTrace() string {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(1, pcs)
+	return formatFrames(pcs[:n], "runtime.gopanic")
+}
+
+// formatFrames formats the frames following the after function, all the frames if after is empty
+// or not on the stack
+func formatFrames(pcs []uintptr, after string) string {
+	if len(pcs) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	var skipped strings.Builder
+	found := after == ""
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if found {
+			fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		} else {
+			fmt.Fprintf(&skipped, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+			found = frame.Function == after
+		}
+		if !more {
+			break
+		}
+	}
+	if sb.Len() == 0 {
+		return strings.TrimSuffix(skipped.String(), "\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
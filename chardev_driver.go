@@ -0,0 +1,274 @@
+//go:build unix
+
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const CharDevDriverID = "chardev"
+
+const (
+	DelimiterFraming = "delimiter"
+	COBSFraming      = "cobs"
+)
+
+const (
+	defaultCharDevDelimiter     = "\n"
+	defaultCharDevMaxWriteSize  = 4096
+	defaultCharDevReopenBackoff = 10 * time.Millisecond
+	// Attempts to write a chunk, reopening the device in between
+	charDevWriteAttempts = 3
+)
+
+type chardevConfig struct {
+	Path             string `json:"path"`             // device or FIFO, e.g. /dev/ttyS0
+	Format           string `json:"format"`           // "text" (default), "json" or "binary"
+	UserReadableTime bool   `json:"userReadableTime"` // text format only
+	Framing          string `json:"framing"`          // "delimiter" (default) or "cobs"; binary requires cobs
+	Delimiter        string `json:"delimiter"`        // appended to each record with delimiter framing, and escaped within it; default "\n"
+	MaxWriteSize     int    `json:"maxWriteSize"`     // bytes per write call, e.g. the UART FIFO size; default 4096
+	ReopenBackoffMs  int    `json:"reopenBackoffMs"`  // delay before reopening after EAGAIN/EPIPE; default 10
+}
+
+// CharDevDriverFactory implements DriverFactoryInterface
+// The drivers it creates are wrapped by SerialDriver since writes to a device can't interleave
+type CharDevDriverFactory struct {
+}
+
+func (f *CharDevDriverFactory) DriverID() DriverID {
+	return DriverID(CharDevDriverID)
+}
+
+func (f *CharDevDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var chardevConfig chardevConfig
+	err := json.Unmarshal(config, &chardevConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal chardev driver config: %w", err)
+	}
+
+	if chardevConfig.Path == "" {
+		return nil, fmt.Errorf("chardev path is required")
+	}
+	switch chardevConfig.Format {
+	case "":
+		chardevConfig.Format = TextFormat
+	case TextFormat, JSONFormat, BinaryFormat:
+	default:
+		return nil, fmt.Errorf("unknown chardev format: %s", chardevConfig.Format)
+	}
+	switch chardevConfig.Framing {
+	case "":
+		chardevConfig.Framing = DelimiterFraming
+	case DelimiterFraming, COBSFraming:
+	default:
+		return nil, fmt.Errorf("unknown chardev framing: %s", chardevConfig.Framing)
+	}
+	if chardevConfig.Format == BinaryFormat && chardevConfig.Framing != COBSFraming {
+		return nil, fmt.Errorf("chardev binary format requires cobs framing")
+	}
+	if chardevConfig.Delimiter == "" {
+		chardevConfig.Delimiter = defaultCharDevDelimiter
+	}
+	if chardevConfig.MaxWriteSize <= 0 {
+		chardevConfig.MaxWriteSize = defaultCharDevMaxWriteSize
+	}
+
+	d := &CharDevDriver{
+		config:        chardevConfig,
+		fd:            -1,
+		reopenBackoff: defaultCharDevReopenBackoff,
+	}
+	if chardevConfig.ReopenBackoffMs > 0 {
+		d.reopenBackoff = time.Duration(chardevConfig.ReopenBackoffMs) * time.Millisecond
+	}
+	if chardevConfig.Framing == DelimiterFraming {
+		d.escaper = strings.NewReplacer(chardevConfig.Delimiter, escapeDelimiter(chardevConfig.Delimiter))
+	}
+	err = d.open()
+	// A FIFO without reader can't be opened yet; it is retried on the next write
+	if err != nil && !errors.Is(err, syscall.ENXIO) {
+		return nil, fmt.Errorf("failed to open chardev %s: %w", chardevConfig.Path, err)
+	}
+	return NewSerialDriver(d), nil
+}
+
+// CharDevDriver implements DriverInterface
+// It writes framed records to a character device or named pipe in non blocking mode. It isn't
+// safe for concurrent use; the factory wraps it by SerialDriver
+type CharDevDriver struct {
+	errorReporter
+
+	config        chardevConfig
+	fd            int
+	reopenBackoff time.Duration
+	escaper       *strings.Replacer // of the delimiter within the records
+}
+
+func (d *CharDevDriver) Log(data map[Param]string) {
+	if d.config.Format == BinaryFormat {
+		d.writeFrame(AppendWireEvent(nil, WireEvent{Type: WireRecord, Params: data}))
+		return
+	}
+	d.writeFrame([]byte(formatRecord(data, d.config.Format, d.config.UserReadableTime)))
+}
+
+func (d *CharDevDriver) BeginTx(id TxID, attr map[Param]string) {
+	if d.config.Format == BinaryFormat {
+		d.writeFrame(AppendWireEvent(nil, WireEvent{Type: WireTxBegin, TxID: id, Params: attr}))
+		return
+	}
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = fmt.Sprintf("TX Begin; Params: %v", attr)
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *CharDevDriver) EndTx(id TxID) {
+	if d.config.Format == BinaryFormat {
+		d.writeFrame(AppendWireEvent(nil, WireEvent{Type: WireTxEnd, TxID: id}))
+		return
+	}
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *CharDevDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	if d.config.Format == BinaryFormat {
+		d.writeFrame(AppendWireEvent(nil, WireEvent{Type: WireTxEnd, TxID: id, Params: map[Param]string{TxStatusParam: string(status)}}))
+		return
+	}
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+}
+
+func (d *CharDevDriver) Stop() {
+	d.close()
+}
+
+func (d *CharDevDriver) writeFrame(payload []byte) {
+	var frame []byte
+	if d.config.Framing == COBSFraming {
+		frame = append(cobsEncode(nil, payload), 0)
+	} else {
+		// A record with line breaks, e.g. a stack trace, stays one frame
+		frame = append([]byte(d.escaper.Replace(string(payload))), d.config.Delimiter...)
+	}
+
+	for len(frame) > 0 {
+		chunk := frame[:min(len(frame), d.config.MaxWriteSize)]
+		err := d.writeChunk(chunk)
+		if err != nil {
+			d.reportError(fmt.Errorf("failed to write to chardev %s: %w", d.config.Path, err))
+			return
+		}
+		frame = frame[len(chunk):]
+	}
+}
+
+// writeChunk writes the whole chunk; the device is reopened when it is full (EAGAIN) or the
+// reader went away (EPIPE)
+func (d *CharDevDriver) writeChunk(chunk []byte) error {
+	var err error
+	for attempt := 0; attempt < charDevWriteAttempts; attempt++ {
+		if attempt > 0 {
+			d.close()
+			time.Sleep(d.reopenBackoff)
+		}
+		if d.fd < 0 {
+			err = d.open()
+			if err != nil {
+				continue
+			}
+		}
+
+		for len(chunk) > 0 {
+			var n int
+			n, err = syscall.Write(d.fd, chunk)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				break
+			}
+			chunk = chunk[n:]
+		}
+		if err == nil {
+			return nil
+		}
+		if err != syscall.EAGAIN && err != syscall.EPIPE {
+			d.close()
+			return err
+		}
+	}
+	return err
+}
+
+func (d *CharDevDriver) open() error {
+	fd, err := syscall.Open(d.config.Path, syscall.O_WRONLY|syscall.O_NONBLOCK|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	d.fd = fd
+	return nil
+}
+
+func (d *CharDevDriver) close() {
+	if d.fd >= 0 {
+		syscall.Close(d.fd)
+		d.fd = -1
+	}
+}
+
+// escapeDelimiter returns the escape sequence of the delimiter: the Go escape of its characters,
+// e.g. \n, or \xHH bytes when it is printable
+func escapeDelimiter(delimiter string) string {
+	quoted := strconv.Quote(delimiter)
+	if escaped := quoted[1 : len(quoted)-1]; escaped != delimiter {
+		return escaped
+	}
+	var sb strings.Builder
+	for i := 0; i < len(delimiter); i++ {
+		fmt.Fprintf(&sb, `\x%02x`, delimiter[i])
+	}
+	return sb.String()
+}
+
+// cobsEncode appends the Consistent Overhead Byte Stuffing encoding of src to dst; the result
+// contains no zero bytes so that a zero can delimit the frames
+func cobsEncode(dst, src []byte) []byte {
+	codeIndex := len(dst)
+	dst = append(dst, 0)
+	code := byte(1)
+	for _, c := range src {
+		if c != 0 {
+			dst = append(dst, c)
+			code++
+		}
+		if c == 0 || code == 0xff {
+			dst[codeIndex] = code
+			codeIndex = len(dst)
+			dst = append(dst, 0)
+			code = 1
+		}
+	}
+	dst[codeIndex] = code
+	return dst
+}
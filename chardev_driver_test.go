@@ -0,0 +1,176 @@
+//go:build unix
+
+package logsystem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// openFIFOReader creates a FIFO and opens its read end, so that the driver can open the write end
+func openFIFOReader(t *testing.T, path string) *os.File {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		require.NoError(t, syscall.Mkfifo(path, 0600))
+	}
+	reader, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	require.NoError(t, err)
+	require.NoError(t, reader.SetReadDeadline(time.Now().Add(time.Second)))
+	return reader
+}
+
+func createCharDevDriver(t *testing.T, config string) DriverInterface {
+	drv, err := (&CharDevDriverFactory{}).CreateDriver(json.RawMessage(config))
+	require.NoError(t, err)
+	t.Cleanup(drv.Stop)
+	return drv
+}
+
+func cobsDecode(t *testing.T, src []byte) []byte {
+	var dst []byte
+	for len(src) > 0 {
+		code := int(src[0])
+		require.NotZero(t, code)
+		require.LessOrEqual(t, code, len(src))
+		dst = append(dst, src[1:code]...)
+		src = src[code:]
+		if code < 0xff && len(src) > 0 {
+			dst = append(dst, 0)
+		}
+	}
+	return dst
+}
+
+func TestCOBSEncode(t *testing.T) {
+	long := bytes.Repeat([]byte{'x'}, 600)
+	for _, src := range [][]byte{
+		{},
+		{0},
+		{0, 0},
+		{1, 2, 0, 3},
+		long,
+		append(append([]byte{}, long[:254]...), 0, 1),
+	} {
+		encoded := cobsEncode(nil, src)
+		require.NotContains(t, encoded, byte(0))
+		require.True(t, bytes.Equal(src, cobsDecode(t, encoded)), "%v", src)
+	}
+	require.Equal(t, []byte{3, 1, 2, 2, 3}, cobsEncode(nil, []byte{1, 2, 0, 3}))
+}
+
+func TestCharDevDriver_DelimiterFraming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uart")
+	reader := openFIFOReader(t, path)
+	defer reader.Close()
+
+	drv := createCharDevDriver(t, `{"path":"`+path+`","format":"json","delimiter":"\r\n","maxWriteSize":8}`)
+	_, ok := drv.(*SerialDriver)
+	require.True(t, ok)
+
+	long := strings.Repeat("abc", 100)
+	drv.Log(map[Param]string{MessageParam: "hello"})
+	drv.Log(map[Param]string{MessageParam: long})
+
+	lines := bufio.NewReader(reader)
+	line, err := lines.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, `{"message":"hello"}`+"\r\n", line)
+	line, err = lines.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, `{"message":"`+long+`"}`+"\r\n", line)
+}
+
+func TestCharDevDriver_EscapesDelimiter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uart")
+	reader := openFIFOReader(t, path)
+	defer reader.Close()
+
+	drv := createCharDevDriver(t, `{"path":"`+path+`"}`)
+	drv.Log(map[Param]string{MessageParam: "panic", LevelParam: string(Error), TimeParam: "10", StackParam: "main.f\n\tmain.go:10"})
+	drv.Log(map[Param]string{MessageParam: "next", LevelParam: string(Info), TimeParam: "11"})
+
+	lines := bufio.NewReader(reader)
+	line, err := lines.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, `[10        ] ERROR panic\nmain.f\n`+"\t"+`main.go:10`+"\n", line)
+	line, err = lines.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "[11        ] INFO  next\n", line)
+
+	require.Equal(t, `\r\n`, escapeDelimiter("\r\n"))
+	require.Equal(t, `\x00`, escapeDelimiter("\x00"))
+	require.Equal(t, `\x7c`, escapeDelimiter("|"))
+}
+
+func TestCharDevDriver_COBSBinary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uart")
+	reader := openFIFOReader(t, path)
+	defer reader.Close()
+
+	drv := createCharDevDriver(t, `{"path":"`+path+`","format":"binary","framing":"cobs"}`)
+	drv.BeginTx(2, map[Param]string{"UserID": "1"})
+	drv.Log(map[Param]string{MessageParam: "inside", TimeParam: "0", TxIDParam: "2"})
+	drv.EndTx(2)
+
+	frames := bufio.NewReader(reader)
+	var events []WireEvent
+	for i := 0; i < 3; i++ {
+		frame, err := frames.ReadBytes(0)
+		require.NoError(t, err)
+		event, err := DecodeWireEvent(cobsDecode(t, frame[:len(frame)-1]))
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+	require.Equal(t, []WireEvent{
+		{Type: WireTxBegin, TxID: 2, Params: map[Param]string{"UserID": "1"}},
+		{Type: WireRecord, Params: map[Param]string{MessageParam: "inside", TimeParam: "0", TxIDParam: "2"}},
+		{Type: WireTxEnd, TxID: 2, Params: map[Param]string{}},
+	}, events)
+}
+
+func TestCharDevDriver_ReopenAfterReaderLeft(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+	require.NoError(t, syscall.Mkfifo(path, 0600))
+
+	// Opening a FIFO without reader is deferred to the first write
+	drv := createCharDevDriver(t, `{"path":"`+path+`","format":"json","reopenBackoffMs":1}`)
+	drv.Log(map[Param]string{MessageParam: "nobody listens"})
+
+	reader := openFIFOReader(t, path)
+	drv.Log(map[Param]string{MessageParam: "one"})
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, `{"message":"one"}`+"\n", line)
+	require.NoError(t, reader.Close())
+
+	// EPIPE, then the reopen fails until a new reader shows up
+	drv.Log(map[Param]string{MessageParam: "lost"})
+
+	reader = openFIFOReader(t, path)
+	defer reader.Close()
+	drv.Log(map[Param]string{MessageParam: "two"})
+	line, err = bufio.NewReader(reader).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, `{"message":"two"}`+"\n", line)
+}
+
+func TestCharDevDriverFactory_InvalidConfig(t *testing.T) {
+	for _, config := range []string{
+		`{}`,
+		`{"path":"/nonexistent/device"}`,
+		`{"path":"/dev/null","format":"xml"}`,
+		`{"path":"/dev/null","framing":"slip"}`,
+		`{"path":"/dev/null","format":"binary"}`,
+	} {
+		_, err := (&CharDevDriverFactory{}).CreateDriver(json.RawMessage(config))
+		require.Error(t, err, config)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const CharDevDriverID = "chardev"
+
+// CharDevDriverFactory implements DriverFactoryInterface; character devices and FIFOs are only supported on unix
+type CharDevDriverFactory struct {
+}
+
+func (f *CharDevDriverFactory) DriverID() DriverID {
+	return DriverID(CharDevDriverID)
+}
+
+func (f *CharDevDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	return nil, errors.New("chardev driver is only supported on unix")
+}
@@ -7,6 +7,17 @@ import (
 
 type Config struct {
 	Drivers map[DriverID]json.RawMessage `json:"drivers"`
+	Logger  LoggerConfig                 `json:"logger"`
+	Enrich  *EnrichConfig                `json:"enrich"`
+	Routes  []RouteRule                  `json:"routes"`
+}
+
+// LoggerConfig holds the options applied by the Logger to every record
+type LoggerConfig struct {
+	// CaptureCaller adds file, line and function of the log call to each record
+	CaptureCaller bool `json:"captureCaller"`
+	// StackTraceOnError adds the stack trace of the log call to Error records
+	StackTraceOnError bool `json:"stackTraceOnError"`
 }
 
 func LoadConfigFromFile(filename string) (Config, error) {
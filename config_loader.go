@@ -1,6 +1,12 @@
 package logsystem
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
 
 type failedDriver struct {
 	id  DriverID
@@ -13,41 +19,107 @@ var (
 )
 
 func CreateLogManagerWithConfig(factories []DriverFactoryInterface, config Config) (*DriverManager, error) {
-	drivers, failedDrivers := matchConfigWithDrivers(factories, config)
+	err := validateRoutes(config.Routes, config.Drivers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+
+	drivers, ids, failedDrivers := matchConfigWithDrivers(factories, config)
 	if (len(drivers) == 0) && (len(failedDrivers) > 0) {
 		return nil, ErrorAllDriversFailed
 	}
 	mgr := NewManager()
-	mgr.AddDrivers(drivers)
-	if len(failedDrivers) > 0 {
-		for _, failedDriver := range failedDrivers {
-			mgr.log(map[Param]string{
-				"driver_id": string(failedDriver.id),
-				"error":     failedDriver.err.Error(),
-			})
+	if config.Enrich != nil {
+		mgr.SetEnrichment(*config.Enrich)
+	}
+	for i, driver := range drivers {
+		mgr.AddNamedDriver(ids[i], driver)
+	}
+	// Reported to all the drivers, before the routes apply
+	routed := routedDrivers(config.Routes)
+	for _, failedDriver := range failedDrivers {
+		data := map[Param]string{
+			"driver_id": string(failedDriver.id),
+			"error":     failedDriver.err.Error(),
 		}
+		if routed[failedDriver.id] {
+			data[MessageParam] = fmt.Sprintf("Driver %s failed to start; the records routed to it are dropped", failedDriver.id)
+			data[LevelParam] = string(Error)
+		}
+		mgr.log(data)
+	}
+	err = mgr.SetRoutes(config.Routes)
+	if err != nil {
+		mgr.stop()
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+	if len(failedDrivers) > 0 {
 		return mgr, ErrorSomeDriversFailed
 	}
 	return mgr, nil
 }
 
-func matchConfigWithDrivers(factories []DriverFactoryInterface, config Config) (drivers []DriverInterface, failedDrivers []failedDriver) {
+// DriverInstanceSeparator separates the driver type from the instance name in the keys of
+// Config.Drivers, e.g. "file:errors"
+const DriverInstanceSeparator = ":"
+
+// driverType returns the ID of the factory of the driver configured under key: the "type" field
+// of the config, else the part of the key before the instance separator
+func driverType(key DriverID, config json.RawMessage) DriverID {
+	var typed struct {
+		Type DriverID `json:"type"`
+	}
+	if json.Unmarshal(config, &typed) == nil && typed.Type != "" {
+		return typed.Type
+	}
+	driverType, _, _ := strings.Cut(string(key), DriverInstanceSeparator)
+	return DriverID(driverType)
+}
+
+// createConfiguredDriver creates the driver and wraps it by the redaction and the filter of its
+// config
+func createConfiguredDriver(factory DriverFactoryInterface, config json.RawMessage) (DriverInterface, error) {
+	driver, err := factory.CreateDriver(config)
+	if err != nil {
+		return nil, err
+	}
+	driver, err = withRedaction(driver, config)
+	if err != nil {
+		return nil, err
+	}
+	return withFilter(driver, config)
+}
+
+// matchConfigWithDrivers creates a driver per config entry, in the order of the factories and
+// the instances of a factory in the order of their keys. The ID of each driver is its key
+func matchConfigWithDrivers(factories []DriverFactoryInterface, config Config) (drivers []DriverInterface, ids []DriverID, failedDrivers []failedDriver) {
 	failedDrivers = make([]failedDriver, 0)
 	drivers = make([]DriverInterface, 0)
 
+	keys := make([]DriverID, 0, len(config.Drivers))
+	for key := range config.Drivers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
 	for _, factory := range factories {
-		if _, ok := config.Drivers[factory.DriverID()]; ok {
-			driver, crErr := factory.CreateDriver(config.Drivers[factory.DriverID()])
+		for _, key := range keys {
+			driverConfig := config.Drivers[key]
+			if driverType(key, driverConfig) != factory.DriverID() {
+				continue
+			}
+			driver, crErr := createConfiguredDriver(factory, driverConfig)
 			if crErr != nil {
 				failedDrivers = append(failedDrivers, failedDriver{
-					id:  factory.DriverID(),
+					id:  key,
 					err: crErr,
 				})
 				continue
 			}
 			drivers = append(drivers, driver)
+			ids = append(ids, key)
 		}
 	}
 
-	return drivers, failedDrivers
+	return drivers, ids, failedDrivers
 }
@@ -3,7 +3,10 @@ package logsystem
 import (
 	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -193,3 +196,41 @@ func TestConfigLoaderIntegration(t *testing.T) {
 		mockDriver.AssertExpectations(t)
 	}
 }
+
+func TestConfigLoader_DriverInstances(t *testing.T) {
+	dir := t.TempDir()
+	config, err := loadConfig([]byte(`{"drivers": {
+		"file": {"filePath": "` + filepath.Join(dir, "app.log") + `", "format": "json"},
+		"file:errors": {"filePath": "` + filepath.Join(dir, "errors.log") + `", "format": "json", "filter": {"levels": ["error"]}},
+		"audit": {"type": "file", "filePath": "` + filepath.Join(dir, "audit.log") + `", "format": "json", "filter": {"components": ["audit"]}}
+	}}`))
+	require.NoError(t, err)
+
+	m, err := CreateLogManagerWithConfig([]DriverFactoryInterface{&FileDriverFactory{}}, config)
+	require.NoError(t, err)
+	require.Equal(t, []DriverID{"audit", "file", "file:errors"}, m.ids)
+
+	l := NewLogger(m)
+	l.Info("started")
+	l.Error("failed")
+	tx := l.BeginTxWithComponent("audit", nil)
+	tx.Info("user created")
+	tx.EndTx()
+	l.Stop()
+
+	messages := func(name string) []string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		var messages []string
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var record map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &record))
+			messages = append(messages, record[string(MessageParam)].(string))
+		}
+		return messages
+	}
+	require.Equal(t, []string{"started", "failed", "TX Begin; Params: map[]", "user created", "TX End"}, messages("app.log"))
+	// The filters apply to the records; every instance gets the transaction events
+	require.Equal(t, []string{"failed", "TX Begin; Params: map[]", "TX End"}, messages("errors.log"))
+	require.Equal(t, []string{"TX Begin; Params: map[]", "user created", "TX End"}, messages("audit.log"))
+}
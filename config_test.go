@@ -39,6 +39,20 @@ func Test_loadConfig(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "enrichment",
+			args: args{
+				data: []byte(`{"enrich":{"hostname":true,"env":["REGION"],"labels":{"service":"api"}}}`),
+			},
+			want: Config{
+				Enrich: &EnrichConfig{
+					Hostname: true,
+					Env:      []string{"REGION"},
+					Labels:   map[Param]string{"service": "api"},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "invalid json",
 			args: args{
@@ -8,7 +8,8 @@ import (
 const ConsoleDriverID = "console"
 
 type consoleConfig struct {
-	UserReadableTime bool `json:"userReadableTime"`
+	UserReadableTime bool   `json:"userReadableTime"`
+	Format           string `json:"format"` // "text" (default) or "json"
 }
 
 // ConsoleDriverFactory implements DriverFactoryInterface
@@ -37,7 +38,7 @@ type ConsoleDriver struct {
 }
 
 func (d *ConsoleDriver) Log(data map[Param]string) {
-	line := formatLine(data, d.config.UserReadableTime)
+	line := formatRecord(data, d.config.Format, d.config.UserReadableTime)
 	fmt.Println(line)
 }
 
@@ -58,5 +59,17 @@ func (d *ConsoleDriver) EndTx(id TxID) {
 	d.Log(txData)
 }
 
+func (d *ConsoleDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+}
+
 func (d *ConsoleDriver) Stop() {
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -49,6 +50,8 @@ func (f *DBDriverFactory) CreateDriver(config json.RawMessage) (drv DriverInterf
 // SQLiteDriver implements DriverInterface
 // It logs
 type SQLiteDriver struct {
+	errorReporter
+
 	config sqliteConfig
 	db     *sql.DB
 }
@@ -64,9 +67,8 @@ func (d *SQLiteDriver) initDB() error {
 
 	attr_columns := ""
 	for _, txAttr := range d.config.TxAttr {
-		attr_columns += fmt.Sprintf("%s TEXT", txAttr)
+		attr_columns += fmt.Sprintf("%s TEXT,", txAttr)
 	}
-	attr_columns += ","
 
 	// TODO: migrate in case of schema changes in the config
 	createTableSQL := fmt.Sprintf(`
@@ -74,6 +76,7 @@ func (d *SQLiteDriver) initDB() error {
 			start_timestamp INTEGER,
 			id INTEGER,
 			end_timestamp INTEGER,
+			status TEXT,
 			%s
 			PRIMARY KEY (start_timestamp, id)
 		)
@@ -84,6 +87,13 @@ func (d *SQLiteDriver) initDB() error {
 		return err
 	}
 
+	err = d.addMissingColumns("transactions", map[string]string{
+		"status": "TEXT",
+	})
+	if err != nil {
+		return err
+	}
+
 	_, err = d.db.Exec(`
 		CREATE TABLE IF NOT EXISTS logs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -92,23 +102,182 @@ func (d *SQLiteDriver) initDB() error {
 			message TEXT,
 			component TEXT,
 			tx_id TEXT,
+			file TEXT,
+			line INTEGER,
+			function TEXT,
+			stack TEXT,
+			error TEXT,
+			repeat_count INTEGER,
+			first_time INTEGER,
+			last_time INTEGER,
+			params TEXT,
 			FOREIGN KEY(tx_id) REFERENCES transactions(id)
 		)
 	`)
+	if err != nil {
+		return err
+	}
+
+	// Databases created by older versions miss the caller, error, repeat and params columns
+	err = d.addMissingColumns("logs", map[string]string{
+		"file":         "TEXT",
+		"line":         "INTEGER",
+		"function":     "TEXT",
+		"stack":        "TEXT",
+		"error":        "TEXT",
+		"repeat_count": "INTEGER",
+		"first_time":   "INTEGER",
+		"last_time":    "INTEGER",
+		"params":       "TEXT",
+	})
+	if err != nil {
+		return err
+	}
+
+	// One row per error of the wrapped-error chain; parent_node is NULL for the logged error
+	_, err = d.db.Exec(`
+		CREATE TABLE IF NOT EXISTS log_errors (
+			log_id INTEGER,
+			node INTEGER,
+			parent_node INTEGER,
+			message TEXT,
+			type TEXT,
+			params TEXT,
+			PRIMARY KEY (log_id, node),
+			FOREIGN KEY(log_id) REFERENCES logs(id)
+		)
+	`)
 	return err
 }
 
+// addMissingColumns adds the columns (name -> type) that are not yet part of the table
+func (d *SQLiteDriver) addMissingColumns(table string, columns map[string]string) error {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		err = rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for name, colType := range columns {
+		if existing[name] {
+			continue
+		}
+		_, err = d.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, name, colType))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *SQLiteDriver) Log(data map[Param]string) {
 	p := extractKnownParams(data)
 
-	_, err := d.db.Exec(`
-		INSERT INTO logs (timestamp, level, message, component, tx_id)
-		VALUES (?, ?, ?, ?, ?)
-	`, p.Timestamp, p.Level, p.Message, p.Component, p.TxID)
+	res, err := d.db.Exec(`
+		INSERT INTO logs (timestamp, level, message, component, tx_id, file, line, function, stack, error, repeat_count, first_time, last_time, params)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, p.Timestamp, p.Level, p.Message, p.Component, p.TxID, p.File, p.Line, p.Function, p.Stack, p.Error,
+		nullableInt(data[RepeatCountParam]), nullableInt(data[FirstTimeParam]), nullableInt(data[LastTimeParam]),
+		otherParams(data))
 
 	if err != nil {
-		fmt.Printf("Failed to log to SQLite database: %v\n", err)
+		d.reportError(fmt.Errorf("failed to log to SQLite database: %w", err))
+		return
 	}
+
+	if chain, ok := data[ErrorChainParam]; ok {
+		logID, err := res.LastInsertId()
+		if err == nil {
+			err = d.logErrorChain(logID, chain)
+		}
+		if err != nil {
+			d.reportError(fmt.Errorf("failed to log error chain to SQLite database: %w", err))
+		}
+	}
+}
+
+// nullableInt stores the params set only by some drivers, e.g. the repeat count of the dedup
+// proxy, as NULL when missing
+func nullableInt(value string) any {
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// sqliteLogColumns are the params stored in their own columns of the logs table
+var sqliteLogColumns = map[Param]bool{
+	TimeParam: true, LevelParam: true, MessageParam: true, ComponentParam: true, TxIDParam: true,
+	FileParam: true, LineParam: true, FunctionParam: true, StackParam: true, ErrorParam: true,
+	ErrorChainParam: true, RepeatCountParam: true, FirstTimeParam: true, LastTimeParam: true,
+}
+
+// otherParams returns the params without a column of their own as a JSON object, or nil if
+// there are none
+func otherParams(data map[Param]string) any {
+	other := make(map[Param]string)
+	for k, v := range data {
+		if !sqliteLogColumns[k] {
+			other[k] = v
+		}
+	}
+	if len(other) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(other)
+	if err != nil {
+		return nil
+	}
+	return string(encoded)
+}
+
+// logErrorChain stores the nodes of the chain in depth first order, each referencing its parent node
+func (d *SQLiteDriver) logErrorChain(logID int64, chain string) error {
+	root, err := parseErrorChain(chain)
+	if err != nil {
+		return err
+	}
+
+	nextNode := 0
+	var insert func(node ErrorNode, parent *int) error
+	insert = func(node ErrorNode, parent *int) error {
+		id := nextNode
+		nextNode++
+
+		var params []byte
+		if len(node.Params) > 0 {
+			params, _ = json.Marshal(node.Params)
+		}
+		_, err := d.db.Exec(`
+			INSERT INTO log_errors (log_id, node, parent_node, message, type, params)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, logID, id, parent, node.Message, node.Type, string(params))
+		if err != nil {
+			return err
+		}
+		for _, wrapped := range node.Wrapped {
+			if err := insert(wrapped, &id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return insert(root, nil)
 }
 
 func (d *SQLiteDriver) BeginTx(id TxID, attr map[Param]string) {
@@ -142,22 +311,32 @@ func (d *SQLiteDriver) BeginTx(id TxID, attr map[Param]string) {
 	// Execute the SQL statement
 	_, err := d.db.Exec(insertSQL, allValues...)
 	if err != nil {
-		fmt.Printf("Failed to log transaction begin to SQLite database: %v\n", err)
+		d.reportError(fmt.Errorf("failed to log transaction begin to SQLite database: %w", err))
 		return
 	}
 }
 
 func (d *SQLiteDriver) EndTx(id TxID) {
+	d.EndTxWithStatus(id, "")
+}
+
+// EndTxWithStatus stores the status of the transaction; an empty status leaves the column NULL
+func (d *SQLiteDriver) EndTxWithStatus(id TxID, status TxStatus) {
 	timestamp := time.Now().Unix()
 
+	var statusValue interface{}
+	if status != "" {
+		statusValue = string(status)
+	}
+
 	_, err := d.db.Exec(`
 		UPDATE transactions
-		SET end_timestamp = ?
+		SET end_timestamp = ?, status = ?
 		WHERE id = ? AND end_timestamp IS NULL
-	`, timestamp, id.String())
+	`, timestamp, statusValue, id.String())
 
 	if err != nil {
-		fmt.Printf("Failed to log transaction end to SQLite database: %v\n", err)
+		d.reportError(fmt.Errorf("failed to log transaction end to SQLite database: %w", err))
 	}
 }
 
@@ -0,0 +1,284 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DedupDriverIDPostfix = "-dedup"
+
+const (
+	ConsecutiveDedupMode = "consecutive"
+	WindowDedupMode      = "window"
+)
+
+const defaultDedupWindow = time.Second
+
+// Params added to the collapsed records
+const (
+	RepeatCountParam Param = "repeat_count"
+	FirstTimeParam   Param = "first_time" // Unix timestamp of the first record of the run
+	LastTimeParam    Param = "last_time"  // Unix timestamp of the last record of the run
+)
+
+type dedupConfig struct {
+	Mode     string          `json:"mode"`     // "consecutive" (default) or "window"
+	WindowMs int             `json:"windowMs"` // window length, or longest run in consecutive mode; default 1000
+	Driver   json.RawMessage `json:"driver"`   // config of the wrapped driver
+}
+
+// DedupDriverFactory implements DriverFactoryInterface
+type DedupDriverFactory struct {
+	provider DriverFactoryInterface
+}
+
+func NewDedupDriverFactory(provider DriverFactoryInterface) *DedupDriverFactory {
+	return &DedupDriverFactory{
+		provider: provider,
+	}
+}
+
+func (f *DedupDriverFactory) DriverID() DriverID {
+	return DriverID(string(f.provider.DriverID()) + DedupDriverIDPostfix)
+}
+
+func (f *DedupDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var dedupConfig dedupConfig
+	err := json.Unmarshal(config, &dedupConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dedup driver config: %w", err)
+	}
+	switch dedupConfig.Mode {
+	case "":
+		dedupConfig.Mode = ConsecutiveDedupMode
+	case ConsecutiveDedupMode, WindowDedupMode:
+	default:
+		return nil, fmt.Errorf("unknown dedup mode: %s", dedupConfig.Mode)
+	}
+	if len(dedupConfig.Driver) == 0 {
+		dedupConfig.Driver = json.RawMessage("{}")
+	}
+
+	provider, err := f.provider.CreateDriver(dedupConfig.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	window := defaultDedupWindow
+	if dedupConfig.WindowMs > 0 {
+		window = time.Duration(dedupConfig.WindowMs) * time.Millisecond
+	}
+	return NewDedupDriver(provider, dedupConfig.Mode, window), nil
+}
+
+type dedupKey struct {
+	level     string
+	message   string
+	component string
+	txID      string
+}
+
+type dedupRun struct {
+	key    dedupKey
+	record map[Param]string
+	count  int
+	first  time.Time // record times
+	last   time.Time
+	opened time.Time // arrival of the first record
+}
+
+// DedupDriver implements DriverInterface
+// It collapses identical records (same level, message, component and transaction) into one
+// record with the repeat_count, first_time and last_time params. In consecutive mode a run ends
+// with the first different record; in window mode the identical records are collapsed until the
+// window opened by the first one closes. Runs are emitted at the latest when the window elapses
+type DedupDriver struct {
+	provider DriverInterface
+	mode     string
+	window   time.Duration
+
+	now func() time.Time
+
+	mutex sync.Mutex
+	runs  []*dedupRun // open runs, oldest first; at most one in consecutive mode
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewDedupDriver(provider DriverInterface, mode string, window time.Duration) *DedupDriver {
+	d := &DedupDriver{
+		provider: provider,
+		mode:     mode,
+		window:   window,
+		now:      time.Now,
+		done:     make(chan struct{}),
+	}
+
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+func (d *DedupDriver) Log(data map[Param]string) {
+	key := dedupKey{
+		level:     data[LevelParam],
+		message:   data[MessageParam],
+		component: data[ComponentParam],
+		txID:      data[TxIDParam],
+	}
+	recorded := recordTime(data)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, run := range d.runs {
+		if run.key == key {
+			run.count++
+			run.last = recorded
+			return
+		}
+	}
+	if d.mode == ConsecutiveDedupMode {
+		d.emitRuns(func(*dedupRun) bool { return true })
+	}
+	d.runs = append(d.runs, &dedupRun{
+		key:    key,
+		record: data,
+		count:  1,
+		first:  recorded,
+		last:   recorded,
+		opened: d.now(),
+	})
+}
+
+// BeginTx emits the open runs first in consecutive mode, to keep the order of the events
+func (d *DedupDriver) BeginTx(id TxID, attr map[Param]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.mode == ConsecutiveDedupMode {
+		d.emitRuns(func(*dedupRun) bool { return true })
+	}
+	d.provider.BeginTx(id, attr)
+}
+
+func (d *DedupDriver) EndTx(id TxID) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.emitTxRuns(id)
+	d.provider.EndTx(id)
+}
+
+func (d *DedupDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.emitTxRuns(id)
+	endTxWithStatus(d.provider, id, status)
+}
+
+// emitTxRuns emits the runs of the transaction before it ends; all of them in consecutive mode
+func (d *DedupDriver) emitTxRuns(id TxID) {
+	txID := id.String()
+	d.emitRuns(func(run *dedupRun) bool {
+		return d.mode == ConsecutiveDedupMode || run.key.txID == txID
+	})
+}
+
+// Flush emits the open runs and flushes the wrapped driver
+func (d *DedupDriver) Flush() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.emitRuns(func(*dedupRun) bool { return true })
+	flushDriver(d.provider)
+}
+
+func (d *DedupDriver) Dump() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	dumpDriver(d.provider)
+}
+
+func (d *DedupDriver) SetErrorHandler(handler func(err error)) {
+	setErrorHandler(d.provider, handler)
+}
+
+func (d *DedupDriver) Health() error {
+	return driverHealth(d.provider)
+}
+
+// ReportsErrorsAsync is true: the collapsed records are written by later calls
+func (d *DedupDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+// Stop emits the open runs and stops the wrapped driver; later calls do nothing
+func (d *DedupDriver) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+		d.wg.Wait()
+
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		d.emitRuns(func(*dedupRun) bool { return true })
+		d.provider.Stop()
+	})
+}
+
+func (d *DedupDriver) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(max(d.window/4, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.emitExpired()
+		}
+	}
+}
+
+// emitExpired emits the runs whose window elapsed
+func (d *DedupDriver) emitExpired() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := d.now()
+	d.emitRuns(func(run *dedupRun) bool {
+		return now.Sub(run.opened) >= d.window
+	})
+}
+
+// emitRuns forwards the runs selected, in the order they were opened, and removes them
+func (d *DedupDriver) emitRuns(selected func(run *dedupRun) bool) {
+	open := d.runs[:0]
+	for _, run := range d.runs {
+		if !selected(run) {
+			open = append(open, run)
+			continue
+		}
+		d.provider.Log(run.collapsed())
+	}
+	clear(d.runs[len(open):])
+	d.runs = open
+}
+
+// collapsed returns the first record of the run, with the repeat params if it was repeated
+func (r *dedupRun) collapsed() map[Param]string {
+	if r.count == 1 {
+		return r.record
+	}
+	record := make(map[Param]string, len(r.record)+3)
+	for k, v := range r.record {
+		record[k] = v
+	}
+	record[RepeatCountParam] = strconv.Itoa(r.count)
+	record[FirstTimeParam] = strconv.FormatInt(r.first.Unix(), 10)
+	record[LastTimeParam] = strconv.FormatInt(r.last.Unix(), 10)
+	return record
+}
@@ -0,0 +1,144 @@
+package logsystem
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupDriver_Consecutive(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewDedupDriver(provider, ConsecutiveDedupMode, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		drv.Log(map[Param]string{MessageParam: "retrying", LevelParam: string(Warn), TimeParam: strconv.Itoa(100 + i)})
+	}
+	require.Empty(t, provider.Records())
+
+	drv.Log(map[Param]string{MessageParam: "connected", LevelParam: string(Info), TimeParam: "105"})
+	records := provider.Records()
+	require.Len(t, records, 1)
+	require.Equal(t, "retrying", records[0][MessageParam])
+	require.Equal(t, "100", records[0][TimeParam])
+	require.Equal(t, "3", records[0][RepeatCountParam])
+	require.Equal(t, "100", records[0][FirstTimeParam])
+	require.Equal(t, "102", records[0][LastTimeParam])
+
+	// A different level, component or transaction starts a new run
+	drv.Log(map[Param]string{MessageParam: "connected", LevelParam: string(Warn), TimeParam: "106"})
+	drv.Log(map[Param]string{MessageParam: "connected", LevelParam: string(Warn), ComponentParam: "db", TimeParam: "107"})
+	drv.Stop()
+	drv.Stop()
+
+	records = provider.Records()
+	require.Equal(t, []string{"retrying", "connected", "connected", "connected"}, messages(records))
+	// Single records are forwarded unchanged
+	require.NotContains(t, records[1], RepeatCountParam)
+	require.True(t, provider.stopped)
+}
+
+func TestDedupDriver_Window(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewDedupDriver(provider, WindowDedupMode, time.Hour)
+	now := time.Unix(100, 0)
+	drv.now = func() time.Time { return now }
+	defer drv.Stop()
+
+	drv.Log(map[Param]string{MessageParam: "a"})
+	drv.Log(map[Param]string{MessageParam: "b"})
+	drv.Log(map[Param]string{MessageParam: "a"})
+	now = now.Add(30 * time.Minute)
+	drv.Log(map[Param]string{MessageParam: "c"})
+	drv.Log(map[Param]string{MessageParam: "a"})
+	require.Empty(t, provider.Records())
+
+	// The windows of a and b closed, c's is still open
+	now = now.Add(40 * time.Minute)
+	drv.emitExpired()
+	records := provider.Records()
+	require.Equal(t, []string{"a", "b"}, messages(records))
+	require.Equal(t, "3", records[0][RepeatCountParam])
+
+	drv.Flush()
+	require.Equal(t, []string{"a", "b", "c"}, messages(provider.Records()))
+	require.Equal(t, 1, provider.flushes)
+}
+
+func TestDedupDriver_EmitsBeforeTxEnd(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewDedupDriver(provider, WindowDedupMode, time.Hour)
+	defer drv.Stop()
+
+	drv.BeginTx(1, nil)
+	drv.Log(map[Param]string{MessageParam: "in tx", TxIDParam: "1"})
+	drv.Log(map[Param]string{MessageParam: "in tx", TxIDParam: "1"})
+	drv.Log(map[Param]string{MessageParam: "outside"})
+	drv.EndTxWithStatus(1, TxFailed)
+
+	records := provider.Records()
+	require.Equal(t, []string{"in tx"}, messages(records))
+	require.Equal(t, "2", records[0][RepeatCountParam])
+	require.Equal(t, []TxID{1}, provider.ends)
+	require.Equal(t, TxFailed, provider.Status(1))
+}
+
+func TestDedupDriver_PeriodicEmit(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewDedupDriver(provider, ConsecutiveDedupMode, 20*time.Millisecond)
+	defer drv.Stop()
+
+	drv.Log(map[Param]string{MessageParam: "stuck"})
+	drv.Log(map[Param]string{MessageParam: "stuck"})
+	require.Eventually(t, func() bool {
+		return len(provider.Records()) == 1
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, "2", provider.Records()[0][RepeatCountParam])
+}
+
+func TestDedupDriver_SQLite(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	factory := NewDedupDriverFactory(&DBDriverFactory{})
+	require.Equal(t, DriverID("sqlite-dedup"), factory.DriverID())
+
+	drv, err := factory.CreateDriver(json.RawMessage(`{"driver":{"dbPath":"` + dbPath + `"}}`))
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		drv.Log(map[Param]string{MessageParam: "disk full", LevelParam: string(Error), TimeParam: strconv.Itoa(200 + i)})
+	}
+	drv.Log(map[Param]string{MessageParam: "disk ok", LevelParam: string(Info), TimeParam: "210"})
+	drv.Stop()
+
+	db, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT message, repeat_count, first_time, last_time FROM logs ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	type row struct {
+		message                          string
+		repeatCount, firstTime, lastTime sql.NullInt64
+	}
+	var result []row
+	for rows.Next() {
+		var r row
+		require.NoError(t, rows.Scan(&r.message, &r.repeatCount, &r.firstTime, &r.lastTime))
+		result = append(result, r)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []row{
+		{"disk full", sql.NullInt64{Int64: 4, Valid: true}, sql.NullInt64{Int64: 200, Valid: true}, sql.NullInt64{Int64: 203, Valid: true}},
+		{message: "disk ok"},
+	}, result)
+}
+
+func TestDedupDriverFactory_InvalidMode(t *testing.T) {
+	_, err := NewDedupDriverFactory(&ConsoleDriverFactory{}).CreateDriver(json.RawMessage(`{"mode":"sliding"}`))
+	require.Error(t, err)
+}
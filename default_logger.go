@@ -0,0 +1,111 @@
+package logsystem
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// ConfigEnvVar names the environment variable pointing at the config file used by the default logger
+const ConfigEnvVar = "LOGSYSTEM_CONFIG"
+
+var (
+	defaultLogger     atomic.Pointer[Logger]
+	defaultLoggerOnce sync.Once
+)
+
+// DefaultDriverFactories returns the factories of the drivers shipped with the package
+func DefaultDriverFactories() []DriverFactoryInterface {
+	return []DriverFactoryInterface{
+		&ConsoleDriverFactory{},
+		&FileDriverFactory{},
+		&DBDriverFactory{},
+	}
+}
+
+// Default returns the package level logger. Unless replaced by SetDefault, it is created on first use
+// from the config file named by ConfigEnvVar or logs to the console if the variable is not set
+func Default() *Logger {
+	if l := defaultLogger.Load(); l != nil {
+		return l
+	}
+	defaultLoggerOnce.Do(func() {
+		defaultLogger.CompareAndSwap(nil, newDefaultLogger())
+	})
+	return defaultLogger.Load()
+}
+
+// SetDefault atomically replaces the package level logger and returns the previous one, if any.
+// The previous logger is not stopped. A nil l restores a logger created as on first use
+func SetDefault(l *Logger) *Logger {
+	if l == nil {
+		l = newDefaultLogger()
+	}
+	return defaultLogger.Swap(l)
+}
+
+func newDefaultLogger() *Logger {
+	configFile := os.Getenv(ConfigEnvVar)
+	if configFile == "" {
+		return newConsoleLogger()
+	}
+
+	l, err := newLoggerFromConfigFile(configFile)
+	if err != nil {
+		l = newConsoleLogger()
+		l.Warn(fmt.Sprintf("Failed to create logger from %s=%s, falling back to console; error: %v", ConfigEnvVar, configFile, err))
+	}
+	return l
+}
+
+func newLoggerFromConfigFile(configFile string) (*Logger, error) {
+	config, err := LoadConfigFromFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	m, err := CreateLogManagerWithConfig(DefaultDriverFactories(), config)
+	if m == nil {
+		return nil, err
+	}
+	// ErrorSomeDriversFailed is already reported through the created drivers
+	return NewLoggerWithConfig(m, config.Logger), nil
+}
+
+func newConsoleLogger() *Logger {
+	m := NewManager()
+	m.AddDriver(NewSerialDriver(&ConsoleDriver{}))
+	return NewLogger(m)
+}
+
+// The package level functions call the logger internals directly to keep the caller depth
+// of the Logger methods. Info, Debug, Warn and Error are taken by the LogLevel constants
+
+func LogInfo(message string) {
+	Default().logBasic(message, Info)
+}
+
+func LogDebug(message string) {
+	Default().logBasic(message, Debug)
+}
+
+func LogWarn(message string) {
+	Default().logBasic(message, Warn)
+}
+
+func LogError(message string) {
+	Default().logBasic(message, Error)
+}
+
+// LogErrorErr logs err and its wrapped-error chain at Error level to the default logger
+func LogErrorErr(err error, message string) {
+	Default().logError(err, message)
+}
+
+func BeginTx(attr map[Param]string) TxLogger {
+	return Default().BeginTxWithComponent("", attr)
+}
+
+func BeginTxWithComponent(component string, attr map[Param]string) TxLogger {
+	return Default().BeginTxWithComponent(component, attr)
+}
@@ -0,0 +1,58 @@
+package logsystem
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultLogger_SetDefault(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{CaptureCaller: true})
+	previous := SetDefault(l)
+	defer SetDefault(previous)
+
+	require.Same(t, l, Default())
+
+	_, _, line, _ := runtime.Caller(0)
+	LogWarn("warn")
+	tx := BeginTxWithComponent("comp", nil)
+	tx.Info("in tx")
+	tx.EndTx()
+
+	records := drv.Records()
+	require.Len(t, records, 2)
+	require.Equal(t, string(Warn), records[0][LevelParam])
+	require.Equal(t, strconv.Itoa(line+1), records[0][LineParam])
+	require.Equal(t, "comp", records[1][ComponentParam])
+	require.Equal(t, []TxID{tx.txID}, drv.ends)
+}
+
+func TestDefaultLogger_FromConfigEnv(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "default.log")
+	configFile := filepath.Join(dir, "config.json")
+	config := `{"drivers":{"file":{"filePath":"` + logFile + `"}}}`
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	t.Setenv(ConfigEnvVar, configFile)
+
+	l := newDefaultLogger()
+	l.Info("from env config")
+	l.Stop()
+
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	require.Contains(t, string(content), "from env config")
+}
+
+func TestDefaultLogger_SetDefaultNil(t *testing.T) {
+	previous := SetDefault(nil)
+	defer SetDefault(previous)
+
+	require.NotNil(t, Default())
+	require.NotSame(t, previous, Default())
+	LogInfo("to the restored default")
+}
@@ -20,11 +20,18 @@ type DriverFactoryInterface interface {
 type Param string
 
 const (
-	MessageParam   Param = "message"
-	TimeParam      Param = "time"  // Unix timestamp
-	LevelParam     Param = "level" // LogLevel
-	ComponentParam Param = "component"
-	TxIDParam      Param = "txID"
+	MessageParam    Param = "message"
+	TimeParam       Param = "time"  // Unix timestamp
+	LevelParam      Param = "level" // LogLevel
+	ComponentParam  Param = "component"
+	TxIDParam       Param = "txID"
+	FileParam       Param = "file"       // source file of the log call
+	LineParam       Param = "line"       // source line of the log call
+	FunctionParam   Param = "function"   // fully qualified function name of the log call
+	StackParam      Param = "stack"      // stack trace at the log call
+	ErrorParam      Param = "error"      // message of the logged error value
+	ErrorChainParam Param = "errorChain" // JSON encoded ErrorNode tree of the wrapped errors
+	TxStatusParam   Param = "txStatus"   // TxStatus
 )
 
 type LogLevel string
@@ -36,6 +43,13 @@ const (
 	Error LogLevel = "error"
 )
 
+type TxStatus string
+
+const (
+	TxSucceeded TxStatus = "succeeded"
+	TxFailed    TxStatus = "failed"
+)
+
 // DriverInterface interface won't be called if the driver is not created successfully, therefore no need to handle creation errors
 type DriverInterface interface {
 	Log(data map[Param]string)
@@ -45,3 +59,79 @@ type DriverInterface interface {
 	// shutdown the driver
 	Stop()
 }
+
+// TxStatusDriverInterface is optionally implemented by drivers that record how a transaction ended;
+// drivers not implementing it get EndTx instead
+type TxStatusDriverInterface interface {
+	EndTxWithStatus(id TxID, status TxStatus)
+}
+
+// FlushDriverInterface is optionally implemented by drivers that buffer data before persisting it
+type FlushDriverInterface interface {
+	Flush()
+}
+
+// DumpDriverInterface is optionally implemented by drivers that keep a history of the records
+// and write it out on demand
+type DumpDriverInterface interface {
+	Dump()
+}
+
+// ErrorReportingDriverInterface is optionally implemented by drivers that report their failures,
+// e.g. a failed write, instead of only printing them
+type ErrorReportingDriverInterface interface {
+	SetErrorHandler(handler func(err error))
+}
+
+// HealthDriverInterface is optionally implemented by drivers that know whether they can currently
+// deliver records; Health returns nil when they can and the problem otherwise
+type HealthDriverInterface interface {
+	Health() error
+}
+
+// AsyncErrorReportingDriverInterface is optionally implemented by drivers that may report the
+// failure of a record after its Log call returned, e.g. with a batch sent in the background, so
+// that an error doesn't tell which record failed
+type AsyncErrorReportingDriverInterface interface {
+	ReportsErrorsAsync() bool
+}
+
+func endTxWithStatus(driver DriverInterface, id TxID, status TxStatus) {
+	if statusDriver, ok := driver.(TxStatusDriverInterface); ok {
+		statusDriver.EndTxWithStatus(id, status)
+		return
+	}
+	driver.EndTx(id)
+}
+
+func flushDriver(driver DriverInterface) {
+	if flusher, ok := driver.(FlushDriverInterface); ok {
+		flusher.Flush()
+	}
+}
+
+func dumpDriver(driver DriverInterface) {
+	if dumper, ok := driver.(DumpDriverInterface); ok {
+		dumper.Dump()
+	}
+}
+
+func setErrorHandler(driver DriverInterface, handler func(err error)) {
+	if reporter, ok := driver.(ErrorReportingDriverInterface); ok {
+		reporter.SetErrorHandler(handler)
+	}
+}
+
+func driverHealth(driver DriverInterface) error {
+	if reporter, ok := driver.(HealthDriverInterface); ok {
+		return reporter.Health()
+	}
+	return nil
+}
+
+func reportsErrorsAsync(driver DriverInterface) bool {
+	if reporter, ok := driver.(AsyncErrorReportingDriverInterface); ok {
+		return reporter.ReportsErrorsAsync()
+	}
+	return false
+}
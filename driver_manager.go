@@ -1,35 +1,158 @@
 package logsystem
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type DriverManager struct {
-	drivers []DriverInterface
+	drivers  []DriverInterface
+	ids      []DriverID // ID of each driver; empty for the drivers added without one
+	errors   []*driverErrors
+	enricher *enricher
+	router   *router
+
+	txMutex sync.Mutex
+	txAttrs map[TxID]map[Param]string // attributes of the open transactions, for routing
+
+	errorHandler atomic.Pointer[func(id DriverID, err error)]
+	healthWindow time.Duration
+	now          func() time.Time
 
 	lastTxID atomic.Int64
 }
 
 func NewManager() *DriverManager {
-	return &DriverManager{}
+	return &DriverManager{
+		healthWindow: defaultHealthWindow,
+		now:          time.Now,
+	}
 }
 
 func (m *DriverManager) AddDriver(driver DriverInterface) {
-	m.drivers = append(m.drivers, driver)
+	m.AddNamedDriver("", driver)
 }
 
 func (m *DriverManager) AddDrivers(drivers []DriverInterface) {
-	m.drivers = append(m.drivers, drivers...)
+	for _, driver := range drivers {
+		m.AddDriver(driver)
+	}
+}
+
+// AddNamedDriver adds a driver the routing rules can refer to by id
+func (m *DriverManager) AddNamedDriver(id DriverID, driver DriverInterface) {
+	counts := &driverErrors{}
+	m.drivers = append(m.drivers, driver)
+	m.ids = append(m.ids, id)
+	m.errors = append(m.errors, counts)
+	setErrorHandler(driver, func(err error) {
+		m.reportError(id, counts, err)
+	})
+}
+
+// SetErrorHandler sets the function called with the errors reported by the drivers. It may be
+// called from the goroutines of the drivers, concurrently; without a handler the errors are printed
+// to stderr
+func (m *DriverManager) SetErrorHandler(handler func(id DriverID, err error)) {
+	m.errorHandler.Store(&handler)
+}
+
+func (m *DriverManager) reportError(id DriverID, counts *driverErrors, err error) {
+	counts.add(err, m.now())
+	if handler := m.errorHandler.Load(); handler != nil && *handler != nil {
+		(*handler)(id, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Driver %s error: %v\n", id, err)
+}
+
+// Health returns the error counts and the state of the drivers. A driver is degraded when it
+// reported an error within the last minute or its own health check fails
+func (m *DriverManager) Health() Health {
+	health := Health{State: Healthy}
+	now := m.now()
+	for i, driver := range m.drivers {
+		h := m.errors[i].health(m.ids[i], driver, now, m.healthWindow)
+		if h.State == Degraded {
+			health.State = Degraded
+		}
+		health.Drivers = append(health.Drivers, h)
+	}
+	return health
+}
+
+// SetRoutes makes the manager send each record only to the drivers of the first matching rule;
+// records matching no rule go to all drivers. The rules refer to the drivers added so far.
+// Transaction begin and end events always go to all drivers
+func (m *DriverManager) SetRoutes(rules []RouteRule) error {
+	if len(rules) == 0 {
+		m.router = nil
+		return nil
+	}
+	r, err := newRouter(rules, m.ids)
+	if err != nil {
+		return err
+	}
+	m.router = r
+	return nil
+}
+
+// SetEnrichment makes the manager add the configured params to every record
+func (m *DriverManager) SetEnrichment(config EnrichConfig) {
+	m.enricher = newEnricher(config)
 }
 
 func (m *DriverManager) log(data map[Param]string) {
-	for _, driver := range m.drivers {
-		driver.Log(data)
+	if m.enricher != nil {
+		data = m.enricher.enrich(data)
 	}
+	if m.router == nil {
+		for _, driver := range m.drivers {
+			driver.Log(data)
+		}
+		return
+	}
+
+	targets, all := m.router.route(data, m.recordTxAttrs(data))
+	if all {
+		for _, driver := range m.drivers {
+			driver.Log(data)
+		}
+		return
+	}
+	for _, i := range targets {
+		m.drivers[i].Log(data)
+	}
+}
+
+// recordTxAttrs returns the attributes of the transaction of the record, if the routing uses them
+func (m *DriverManager) recordTxAttrs(data map[Param]string) map[Param]string {
+	if !m.router.needsTxAttrs {
+		return nil
+	}
+	id, err := strconv.ParseInt(data[TxIDParam], 10, 64)
+	if err != nil {
+		return nil
+	}
+	m.txMutex.Lock()
+	defer m.txMutex.Unlock()
+	return m.txAttrs[TxID(id)]
 }
 
 func (m *DriverManager) beginTx(attr map[Param]string) TxID {
 	txID := TxID(m.lastTxID.Add(1))
+	if m.router != nil && m.router.needsTxAttrs {
+		m.txMutex.Lock()
+		if m.txAttrs == nil {
+			m.txAttrs = make(map[TxID]map[Param]string)
+		}
+		m.txAttrs[txID] = attr
+		m.txMutex.Unlock()
+	}
 
 	for _, driver := range m.drivers {
 		driver.BeginTx(txID, attr)
@@ -38,11 +161,37 @@ func (m *DriverManager) beginTx(attr map[Param]string) TxID {
 }
 
 func (m *DriverManager) endTx(id TxID) {
+	m.forgetTx(id)
 	for _, driver := range m.drivers {
 		driver.EndTx(id)
 	}
 }
 
+func (m *DriverManager) endTxWithStatus(id TxID, status TxStatus) {
+	m.forgetTx(id)
+	for _, driver := range m.drivers {
+		endTxWithStatus(driver, id, status)
+	}
+}
+
+func (m *DriverManager) forgetTx(id TxID) {
+	m.txMutex.Lock()
+	defer m.txMutex.Unlock()
+	delete(m.txAttrs, id)
+}
+
+func (m *DriverManager) flush() {
+	for _, driver := range m.drivers {
+		flushDriver(driver)
+	}
+}
+
+func (m *DriverManager) dump() {
+	for _, driver := range m.drivers {
+		dumpDriver(driver)
+	}
+}
+
 func (m *DriverManager) stop() {
 	for _, driver := range m.drivers {
 		driver.Stop()
@@ -0,0 +1,304 @@
+package logsystem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ElasticsearchDriverID = "elasticsearch"
+
+const (
+	defaultElasticsearchIndex = "logs-%{+yyyy.MM.dd}"
+	elasticsearchBulkPath     = "/_bulk"
+)
+
+// Converts the date tokens of the index pattern to the Go layout
+var elasticsearchDateTokens = strings.NewReplacer(
+	"yyyy", "2006",
+	"yy", "06",
+	"MM", "01",
+	"dd", "02",
+	"HH", "15",
+)
+
+// ECS fields of the standard params; the other params go to labels.*
+var elasticsearchECSFields = map[Param]string{
+	MessageParam:    "message",
+	LevelParam:      "log.level",
+	TxIDParam:       "transaction.id",
+	FileParam:       "log.origin.file.name",
+	LineParam:       "log.origin.file.line",
+	FunctionParam:   "log.origin.function",
+	ErrorParam:      "error.message",
+	StackParam:      "error.stack_trace",
+	ErrorChainParam: "error.chain",
+}
+
+type elasticsearchConfig struct {
+	httpConfig // url is the cluster base URL; requests go to /_bulk
+	batchConfig
+
+	Index  string `json:"index"`  // index name; %{+yyyy.MM.dd} is replaced by the record date, default logs-%{+yyyy.MM.dd}
+	OpType string `json:"opType"` // create (default, required by data streams) or index
+	APIKey string `json:"apiKey"` // sent as "Authorization: ApiKey <apiKey>"
+}
+
+// ElasticsearchDriverFactory implements DriverFactoryInterface
+type ElasticsearchDriverFactory struct {
+}
+
+func (f *ElasticsearchDriverFactory) DriverID() DriverID {
+	return DriverID(ElasticsearchDriverID)
+}
+
+func (f *ElasticsearchDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var esConfig elasticsearchConfig
+	err := json.Unmarshal(config, &esConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal elasticsearch driver config: %w", err)
+	}
+
+	if esConfig.Index == "" {
+		esConfig.Index = defaultElasticsearchIndex
+	}
+	switch esConfig.OpType {
+	case "":
+		esConfig.OpType = "create"
+	case "create", "index":
+	default:
+		return nil, fmt.Errorf("unknown elasticsearch op type: %s", esConfig.OpType)
+	}
+	esConfig.URL = strings.TrimSuffix(esConfig.URL, "/")
+	if esConfig.APIKey != "" {
+		headers := map[string]string{"Authorization": "ApiKey " + esConfig.APIKey}
+		for k, v := range esConfig.Headers {
+			headers[k] = v
+		}
+		esConfig.Headers = headers
+	}
+
+	sender, err := newHTTPSender(esConfig.httpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid elasticsearch driver config: %w", err)
+	}
+
+	d := &ElasticsearchDriver{
+		config: esConfig,
+		sender: sender,
+	}
+	d.batcher = newBatcher("elasticsearch", esConfig.batchConfig, d.bulk, &d.errorReporter)
+	return d, nil
+}
+
+type elasticsearchDoc struct {
+	index  string
+	source []byte
+}
+
+// ElasticsearchDriver implements DriverInterface
+// It sends the records as ECS documents through the bulk API; only the documents rejected with
+// a transient error are retried
+type ElasticsearchDriver struct {
+	errorReporter
+
+	config  elasticsearchConfig
+	sender  *httpSender
+	batcher *batcher[elasticsearchDoc]
+}
+
+func (d *ElasticsearchDriver) Log(data map[Param]string) {
+	doc, err := d.newDoc(data)
+	if err != nil {
+		d.reportError(fmt.Errorf("failed to encode elasticsearch document: %w", err))
+		return
+	}
+	d.batcher.add(doc)
+}
+
+func (d *ElasticsearchDriver) BeginTx(id TxID, attr map[Param]string) {
+	txData := make(map[Param]string)
+	for k, v := range attr {
+		txData[k] = v
+	}
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX Begin"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *ElasticsearchDriver) EndTx(id TxID) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *ElasticsearchDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+}
+
+func (d *ElasticsearchDriver) Flush() {
+	d.batcher.flush()
+}
+
+// ReportsErrorsAsync is true: the records are sent in batches
+func (d *ElasticsearchDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+func (d *ElasticsearchDriver) Stop() {
+	d.batcher.stop()
+}
+
+func (d *ElasticsearchDriver) newDoc(data map[Param]string) (elasticsearchDoc, error) {
+	timestamp := recordTime(data).UTC()
+
+	doc := map[string]any{
+		"@timestamp": timestamp.Format(time.RFC3339Nano),
+	}
+	labels := map[string]any{}
+	for k, v := range data {
+		if k == TimeParam {
+			continue
+		}
+		field, ok := elasticsearchECSFields[k]
+		if !ok {
+			// Label names can't contain dots
+			labels[strings.ReplaceAll(string(k), ".", "_")] = v
+			continue
+		}
+
+		var value any = v
+		if k == LineParam {
+			if line, err := strconv.Atoi(v); err == nil {
+				value = line
+			}
+		}
+		if k == ErrorChainParam && json.Valid([]byte(v)) {
+			value = json.RawMessage(v)
+		}
+		setNestedField(doc, field, value)
+	}
+	if len(labels) > 0 {
+		doc["labels"] = labels
+	}
+
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return elasticsearchDoc{}, err
+	}
+	return elasticsearchDoc{
+		index:  d.indexName(timestamp),
+		source: source,
+	}, nil
+}
+
+// indexName replaces the %{+<date format>} sections of the index pattern
+func (d *ElasticsearchDriver) indexName(timestamp time.Time) string {
+	pattern := d.config.Index
+	var sb strings.Builder
+	for {
+		start := strings.Index(pattern, "%{+")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(pattern[start:], "}")
+		if end < 0 {
+			break
+		}
+		sb.WriteString(pattern[:start])
+		layout := elasticsearchDateTokens.Replace(pattern[start+3 : start+end])
+		sb.WriteString(timestamp.Format(layout))
+		pattern = pattern[start+end+1:]
+	}
+	sb.WriteString(pattern)
+	return sb.String()
+}
+
+// setNestedField sets a dotted ECS field as nested objects, e.g. log.level -> {"log":{"level":...}}
+func setNestedField(doc map[string]any, field string, value any) {
+	parts := strings.Split(field, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// bulk sends the documents as NDJSON and returns the documents rejected with a transient error
+func (d *ElasticsearchDriver) bulk(docs []elasticsearchDoc) ([]elasticsearchDoc, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		action, err := json.Marshal(map[string]any{d.config.OpType: map[string]string{"_index": doc.index}})
+		if err != nil {
+			return nil, &permanentError{err: err}
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.source)
+		body.WriteByte('\n')
+	}
+
+	respBody, err := d.sender.post(d.config.URL+elasticsearchBulkPath, body.Bytes(), "application/x-ndjson", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp elasticsearchBulkResponse
+	err = json.Unmarshal(respBody, &resp)
+	if err != nil {
+		return nil, &permanentError{err: fmt.Errorf("invalid bulk response: %w", err)}
+	}
+	if !resp.Errors {
+		return nil, nil
+	}
+	if len(resp.Items) != len(docs) {
+		return nil, &permanentError{err: fmt.Errorf("bulk response has %d items for %d documents", len(resp.Items), len(docs))}
+	}
+
+	var retry []elasticsearchDoc
+	var lastErr string
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			lastErr = fmt.Sprintf("status %d: %s", result.Status, result.Error)
+			if result.Status == 429 || result.Status >= 500 {
+				retry = append(retry, docs[i])
+			} else {
+				d.reportError(fmt.Errorf("elasticsearch rejected document for index %s; %s", docs[i].index, lastErr))
+			}
+		}
+	}
+	if len(retry) > 0 {
+		return retry, fmt.Errorf("%d documents failed; last error: %s", len(retry), lastErr)
+	}
+	return nil, nil
+}
@@ -0,0 +1,91 @@
+package logsystem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type bulkItem struct {
+	action map[string]map[string]string
+	source map[string]any
+}
+
+func parseBulkBody(t *testing.T, body []byte) []bulkItem {
+	var items []bulkItem
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var item bulkItem
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &item.action))
+		require.True(t, scanner.Scan())
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &item.source))
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestElasticsearchDriver_RetriesOnlyFailedDocuments(t *testing.T) {
+	var mutex sync.Mutex
+	var received []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, recordRequest(r))
+
+		if len(received) == 1 {
+			w.Write([]byte(`{"errors":true,"items":[
+				{"create":{"status":201}},
+				{"create":{"status":429,"error":{"type":"es_rejected_execution_exception"}}},
+				{"create":{"status":400,"error":{"type":"mapper_parsing_exception"}}}
+			]}`))
+			return
+		}
+		w.Write([]byte(`{"errors":false,"items":[{"create":{"status":201}}]}`))
+	}))
+	defer server.Close()
+
+	drv, err := (&ElasticsearchDriverFactory{}).CreateDriver(json.RawMessage(`{
+		"url": "` + server.URL + `",
+		"apiKey": "secret",
+		"index": "app-%{+yyyy.MM.dd}-logs",
+		"retryBackoffMs": 1
+	}`))
+	require.NoError(t, err)
+
+	drv.Log(map[Param]string{MessageParam: "one", LevelParam: "info", TimeParam: "1700000000", TxIDParam: "4", "UserID": "123", "a.b": "c"})
+	drv.Log(map[Param]string{MessageParam: "two", LevelParam: "warn", TimeParam: "1700000000", LineParam: "42"})
+	drv.Log(map[Param]string{MessageParam: "three", LevelParam: "error", TimeParam: "1700000000"})
+	drv.Stop()
+
+	var requests [][]bulkItem
+	for _, req := range received {
+		require.NoError(t, req.err)
+		require.Equal(t, "/_bulk", req.path)
+		require.Equal(t, "application/x-ndjson", req.header.Get("Content-Type"))
+		require.Equal(t, "ApiKey secret", req.header.Get("Authorization"))
+		requests = append(requests, parseBulkBody(t, req.body))
+	}
+	require.Len(t, requests, 2)
+	require.Len(t, requests[0], 3)
+
+	first := requests[0][0]
+	require.Equal(t, map[string]map[string]string{"create": {"_index": "app-2023.11.14-logs"}}, first.action)
+	require.Equal(t, map[string]any{
+		"@timestamp":  "2023-11-14T22:13:20Z",
+		"message":     "one",
+		"log":         map[string]any{"level": "info"},
+		"transaction": map[string]any{"id": "4"},
+		"labels":      map[string]any{"UserID": "123", "a_b": "c"},
+	}, first.source)
+
+	require.Len(t, requests[1], 1)
+	retried := requests[1][0].source
+	require.Equal(t, "two", retried["message"])
+	require.Equal(t, map[string]any{"level": "warn", "origin": map[string]any{"file": map[string]any{"line": float64(42)}}}, retried["log"])
+}
@@ -0,0 +1,81 @@
+package logsystem
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+)
+
+// Params added by the enrichment
+const (
+	HostnameParam   Param = "hostname"
+	PIDParam        Param = "pid"
+	GoroutinesParam Param = "goroutines" // number of goroutines when the record was logged
+	VersionParam    Param = "version"    // version of the main module
+)
+
+// EnrichConfig selects the params the DriverManager adds to every record
+type EnrichConfig struct {
+	Hostname   bool             `json:"hostname"`
+	PID        bool             `json:"pid"`
+	Goroutines bool             `json:"goroutines"`
+	BuildInfo  bool             `json:"buildInfo"` // version of the main module from debug.ReadBuildInfo
+	Env        []string         `json:"env"`       // environment variables added under their names
+	Labels     map[Param]string `json:"labels"`    // static params, e.g. service or region
+}
+
+// enricher adds the configured params to the records, without overwriting the params logged
+type enricher struct {
+	static     map[Param]string
+	goroutines bool
+}
+
+func newEnricher(config EnrichConfig) *enricher {
+	e := &enricher{
+		static:     make(map[Param]string),
+		goroutines: config.Goroutines,
+	}
+
+	for k, v := range config.Labels {
+		e.static[k] = v
+	}
+	for _, name := range config.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			e.static[Param(name)] = value
+		}
+	}
+	if config.Hostname {
+		hostname, err := os.Hostname()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get the hostname: %v\n", err)
+		} else {
+			e.static[HostnameParam] = hostname
+		}
+	}
+	if config.PID {
+		e.static[PIDParam] = strconv.Itoa(os.Getpid())
+	}
+	if config.BuildInfo {
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			e.static[VersionParam] = info.Main.Version
+		}
+	}
+	return e
+}
+
+// enrich returns a copy of data with the enrichment params
+func (e *enricher) enrich(data map[Param]string) map[Param]string {
+	enriched := make(map[Param]string, len(data)+len(e.static)+1)
+	for k, v := range e.static {
+		enriched[k] = v
+	}
+	if e.goroutines {
+		enriched[GoroutinesParam] = strconv.Itoa(runtime.NumGoroutine())
+	}
+	for k, v := range data {
+		enriched[k] = v
+	}
+	return enriched
+}
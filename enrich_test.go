@@ -0,0 +1,99 @@
+package logsystem
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverManager_Enrichment(t *testing.T) {
+	t.Setenv("ENRICH_TEST_REGION", "eu-west-1")
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	drv := &RecordingDriver{}
+	m := NewManager()
+	m.AddDriver(drv)
+	m.SetEnrichment(EnrichConfig{
+		Hostname:   true,
+		PID:        true,
+		Goroutines: true,
+		Env:        []string{"ENRICH_TEST_REGION", "ENRICH_TEST_UNSET"},
+		Labels:     map[Param]string{"service": "api", ComponentParam: "default"},
+	})
+
+	data := map[Param]string{MessageParam: "started", ComponentParam: "http"}
+	m.log(data)
+
+	records := drv.Records()
+	require.Len(t, records, 1)
+	record := records[0]
+	require.Equal(t, hostname, record[HostnameParam])
+	require.Equal(t, strconv.Itoa(os.Getpid()), record[PIDParam])
+	require.NotEmpty(t, record[GoroutinesParam])
+	require.Equal(t, "eu-west-1", record["ENRICH_TEST_REGION"])
+	require.NotContains(t, record, Param("ENRICH_TEST_UNSET"))
+	require.Equal(t, "api", record["service"])
+	// The logged params take precedence
+	require.Equal(t, "http", record[ComponentParam])
+	require.Len(t, data, 2)
+}
+
+func TestDriverManager_EnrichmentSQLite(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	config := Config{
+		Drivers: map[DriverID]json.RawMessage{
+			SQLiteDriverID: json.RawMessage(`{"dbPath":"` + dbPath + `"}`),
+		},
+		Enrich: &EnrichConfig{Labels: map[Param]string{"service": "api"}},
+	}
+	mgr, err := CreateLogManagerWithConfig([]DriverFactoryInterface{&DBDriverFactory{}}, config)
+	require.NoError(t, err)
+	NewLogger(mgr).Info("started")
+	mgr.stop()
+
+	db, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var params string
+	require.NoError(t, db.QueryRow("SELECT params FROM logs").Scan(&params))
+	require.JSONEq(t, `{"service":"api"}`, params)
+}
+
+func TestDriverManager_EnrichmentText(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	config := Config{
+		Drivers: map[DriverID]json.RawMessage{
+			ConsoleDriverID: json.RawMessage(`{}`),
+			FileDriverID:    json.RawMessage(`{"filePath":"` + logPath + `"}`),
+		},
+		Enrich: &EnrichConfig{PID: true, Labels: map[Param]string{"service": "api"}},
+	}
+	mgr, err := CreateLogManagerWithConfig([]DriverFactoryInterface{&ConsoleDriverFactory{}, &FileDriverFactory{}}, config)
+	require.NoError(t, err)
+
+	reader, writer, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = writer
+	NewLogger(mgr).Info("started")
+	os.Stdout = stdout
+	require.NoError(t, writer.Close())
+	console, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	mgr.stop()
+
+	file, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	suffix := "started; pid=[" + strconv.Itoa(os.Getpid()) + "]; service=[api]\n"
+	require.True(t, strings.HasSuffix(string(console), suffix), string(console))
+	require.True(t, strings.HasSuffix(string(file), suffix), string(file))
+}
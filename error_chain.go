@@ -0,0 +1,106 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrorParamsProvider can be implemented by error types to contribute their own params to the record
+type ErrorParamsProvider interface {
+	LogParams() map[Param]string
+}
+
+// ErrorNode describes one error of a wrapped-error chain; ErrorChainParam holds the JSON encoded root node
+type ErrorNode struct {
+	Message string           `json:"message"`
+	Type    string           `json:"type"`
+	Params  map[Param]string `json:"params,omitempty"`
+	Wrapped []ErrorNode      `json:"wrapped,omitempty"`
+}
+
+// Guards against errors that unwrap into themselves
+const maxErrorChainDepth = 32
+
+// Params set by the logger that error types can't override
+var builtinParams = map[Param]bool{
+	MessageParam:    true,
+	TimeParam:       true,
+	LevelParam:      true,
+	ComponentParam:  true,
+	TxIDParam:       true,
+	FileParam:       true,
+	LineParam:       true,
+	FunctionParam:   true,
+	StackParam:      true,
+	ErrorParam:      true,
+	ErrorChainParam: true,
+	TxStatusParam:   true,
+}
+
+// errorParams returns the record params describing err and its errors.Unwrap/errors.Join chain
+func errorParams(err error) map[Param]string {
+	if err == nil {
+		return nil
+	}
+
+	params := make(map[Param]string)
+	root := buildErrorNode(err, 0, params)
+
+	params[ErrorParam] = err.Error()
+	chain, jsonErr := json.Marshal(root)
+	if jsonErr == nil {
+		params[ErrorChainParam] = string(chain)
+	}
+	return params
+}
+
+// buildErrorNode walks the chain depth first; params contributed by outer errors take precedence.
+// The built-in params are kept in the node only
+func buildErrorNode(err error, depth int, params map[Param]string) ErrorNode {
+	node := ErrorNode{
+		Message: err.Error(),
+		Type:    fmt.Sprintf("%T", err),
+	}
+
+	if provider, ok := err.(ErrorParamsProvider); ok {
+		node.Params = provider.LogParams()
+		for k, v := range node.Params {
+			if _, exists := params[k]; !exists && !builtinParams[k] {
+				params[k] = v
+			}
+		}
+	}
+
+	if depth >= maxErrorChainDepth {
+		return node
+	}
+
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, wrapped := range e.Unwrap() {
+			if wrapped != nil {
+				node.Wrapped = append(node.Wrapped, buildErrorNode(wrapped, depth+1, params))
+			}
+		}
+	default:
+		if wrapped := errors.Unwrap(err); wrapped != nil {
+			node.Wrapped = append(node.Wrapped, buildErrorNode(wrapped, depth+1, params))
+		}
+	}
+	return node
+}
+
+// parseErrorChain decodes the ErrorChainParam value
+func parseErrorChain(value string) (ErrorNode, error) {
+	var node ErrorNode
+	err := json.Unmarshal([]byte(value), &node)
+	return node, err
+}
+
+func errorMessage(err error, message string) string {
+	if message == "" && err != nil {
+		return err.Error()
+	}
+	return message
+}
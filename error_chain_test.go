@@ -0,0 +1,105 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type codedError struct {
+	code string
+}
+
+func (e *codedError) Error() string {
+	return "coded " + e.code
+}
+
+func (e *codedError) LogParams() map[Param]string {
+	return map[Param]string{"code": e.code}
+}
+
+func TestLogger_ErrorErrChain(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{})
+
+	base := &codedError{code: "E42"}
+	err := fmt.Errorf("request failed: %w", errors.Join(base, errors.New("second")))
+
+	l.ErrorErr(err, "")
+	tl := l.BeginTxWithComponent("comp", nil)
+	tl.ErrorErr(err, "in tx")
+
+	records := drv.Records()
+	require.Len(t, records, 2)
+	require.Equal(t, err.Error(), records[0][MessageParam])
+	require.Equal(t, "in tx", records[1][MessageParam])
+	require.Equal(t, "1", records[1][TxIDParam])
+
+	for _, record := range records {
+		require.Equal(t, string(Error), record[LevelParam])
+		require.Equal(t, err.Error(), record[ErrorParam])
+		require.Equal(t, "E42", record["code"])
+
+		root, parseErr := parseErrorChain(record[ErrorChainParam])
+		require.NoError(t, parseErr)
+		require.Equal(t, "*fmt.wrapError", root.Type)
+		require.Len(t, root.Wrapped, 1)
+		joined := root.Wrapped[0]
+		require.Len(t, joined.Wrapped, 2)
+		require.Equal(t, "coded E42", joined.Wrapped[0].Message)
+		require.Equal(t, map[Param]string{"code": "E42"}, joined.Wrapped[0].Params)
+		require.Equal(t, "second", joined.Wrapped[1].Message)
+	}
+}
+
+func TestFormatJSON_KeepsChainStructure(t *testing.T) {
+	data := map[Param]string{
+		MessageParam: "failed",
+		TimeParam:    "1700000000",
+		LevelParam:   string(Error),
+	}
+	for k, v := range errorParams(fmt.Errorf("outer: %w", errors.New("inner"))) {
+		data[k] = v
+	}
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal([]byte(formatJSON(data)), &decoded))
+	require.Equal(t, float64(1700000000), decoded["time"])
+	chain, ok := decoded["errorChain"].(map[string]any)
+	require.True(t, ok)
+	require.Equal(t, "outer: inner", chain["message"])
+	require.Len(t, chain["wrapped"], 1)
+}
+
+type overridingError struct{}
+
+func (e overridingError) Error() string {
+	return "overriding"
+}
+
+func (e overridingError) LogParams() map[Param]string {
+	return map[Param]string{MessageParam: "spoofed", LevelParam: string(Debug), TxIDParam: "99", "code": "E1"}
+}
+
+func TestLogger_ErrorParamsCannotOverrideBuiltins(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{})
+
+	l.ErrorErr(overridingError{}, "failed")
+	tl := l.BeginTx(nil)
+	tl.ErrorErr(overridingError{}, "")
+
+	records := drv.Records()
+	require.Len(t, records, 2)
+	require.Equal(t, "failed", records[0][MessageParam])
+	require.Equal(t, "overriding", records[1][MessageParam])
+	require.Equal(t, "1", records[1][TxIDParam])
+	for _, record := range records {
+		require.Equal(t, string(Error), record[LevelParam])
+		require.Equal(t, "E1", record["code"])
+		root, err := parseErrorChain(record[ErrorChainParam])
+		require.NoError(t, err)
+		require.Equal(t, "spoofed", root.Params[MessageParam])
+	}
+}
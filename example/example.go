@@ -13,6 +13,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 2 && os.Args[2] == "--dry-run" {
+		routes, err := logsystem.DescribeRoutes(conf)
+		if err != nil {
+			fmt.Println("Invalid routes:", err)
+			os.Exit(2)
+		}
+		fmt.Print(routes)
+		return
+	}
+
 	m, err := logsystem.CreateLogManagerWithConfig(
 		[]logsystem.DriverFactoryInterface{
 			&logsystem.ConsoleDriverFactory{},
@@ -28,8 +38,10 @@ func main() {
 		fmt.Println("Some drivers failed to initialize; check logs for details")
 	}
 
-	l := logsystem.NewLogger(m)
+	l := logsystem.NewLoggerWithConfig(m, conf.Logger)
 	defer l.Stop()
+	logsystem.RegisterPanicFlush(l)
+	defer logsystem.HandlePanic()
 	l.Info("Hello, world!")
 	tl := l.BeginTx(map[logsystem.Param]string{"UserID": "123"})
 	tl.Warn("Doing something in TX")
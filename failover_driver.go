@@ -0,0 +1,357 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+const FailoverDriverID = "failover"
+
+const (
+	defaultFailoverProbeInterval = 5 * time.Second
+	defaultFailoverMaxReplay     = 10000
+)
+
+type failoverConfig struct {
+	Drivers         []map[DriverID]json.RawMessage `json:"drivers"`         // child driver configs, one driver each, in order of preference
+	ProbeIntervalMs int                            `json:"probeIntervalMs"` // how long a failed child is skipped before it's tried again; default 5000
+	Replay          bool                           `json:"replay"`          // resend the records written to a fallback to the primary once it recovers
+	MaxReplay       int                            `json:"maxReplay"`       // records kept for the replay, the oldest are dropped; default 10000
+}
+
+// FailoverDriverFactory implements DriverFactoryInterface
+type FailoverDriverFactory struct {
+	factories []DriverFactoryInterface
+}
+
+// NewFailoverDriverFactory takes the factories available for the child drivers
+func NewFailoverDriverFactory(factories ...DriverFactoryInterface) *FailoverDriverFactory {
+	return &FailoverDriverFactory{
+		factories: factories,
+	}
+}
+
+func (f *FailoverDriverFactory) DriverID() DriverID {
+	return DriverID(FailoverDriverID)
+}
+
+func (f *FailoverDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var failoverConfig failoverConfig
+	err := json.Unmarshal(config, &failoverConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal failover driver config: %w", err)
+	}
+	if len(failoverConfig.Drivers) < 2 {
+		return nil, fmt.Errorf("failover requires at least two drivers")
+	}
+
+	var children []DriverInterface
+	var ids []DriverID
+	for _, childConfig := range failoverConfig.Drivers {
+		id, child, err := f.createChild(childConfig)
+		if err != nil {
+			for _, created := range children {
+				created.Stop()
+			}
+			return nil, err
+		}
+		children = append(children, child)
+		ids = append(ids, id)
+	}
+
+	probeInterval := defaultFailoverProbeInterval
+	if failoverConfig.ProbeIntervalMs > 0 {
+		probeInterval = time.Duration(failoverConfig.ProbeIntervalMs) * time.Millisecond
+	}
+	d := newFailoverDriver(children, ids, probeInterval)
+	d.replay = failoverConfig.Replay
+	if failoverConfig.MaxReplay > 0 {
+		d.maxReplay = failoverConfig.MaxReplay
+	}
+	return d, nil
+}
+
+func (f *FailoverDriverFactory) createChild(config map[DriverID]json.RawMessage) (DriverID, DriverInterface, error) {
+	if len(config) != 1 {
+		return "", nil, fmt.Errorf("each failover driver entry must configure exactly one driver")
+	}
+	for key, driverConfig := range config {
+		for _, factory := range f.factories {
+			if driverType(key, driverConfig) != factory.DriverID() {
+				continue
+			}
+			driver, err := createConfiguredDriver(factory, driverConfig)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to create failover driver %s: %w", key, err)
+			}
+			return key, driver, nil
+		}
+		return "", nil, fmt.Errorf("unknown failover driver: %s", key)
+	}
+	return "", nil, nil
+}
+
+type failoverChild struct {
+	id       DriverID
+	driver   DriverInterface
+	failedAt time.Time // zero while the child is usable
+	errors   int       // errors reported, to detect the failure of a write
+}
+
+// FailoverDriver implements DriverInterface
+// It writes the records to the first usable child driver. A child becomes unusable when it
+// reports an error or its health check fails, and is tried again after the probe interval if its
+// health check passes. A record whose write reports an error is written to the next usable child.
+// With replay, the records written to a fallback are resent to the primary once it recovers; the
+// primary gets the records again only once the replay is done. Transaction begin and end events
+// go to all children, so that each of them knows the transactions of the records it may receive.
+// The errors of the children sending in batches (loki, elasticsearch, otlp, fluent) are reported
+// after the write, so the records of a failed batch are lost; put a spool in front of them
+type FailoverDriver struct {
+	errorReporter
+
+	children      []*failoverChild
+	probeInterval time.Duration
+	replay        bool
+	maxReplay     int
+
+	now func() time.Time
+
+	mutex   sync.Mutex
+	pending []map[Param]string // records to replay to the primary
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewFailoverDriver writes to the children in order of preference; a failed child is skipped
+// for probeInterval at least
+func NewFailoverDriver(children []DriverInterface, probeInterval time.Duration) *FailoverDriver {
+	ids := make([]DriverID, len(children))
+	for i := range children {
+		ids[i] = DriverID(fmt.Sprintf("#%d", i))
+	}
+	return newFailoverDriver(children, ids, probeInterval)
+}
+
+func newFailoverDriver(children []DriverInterface, ids []DriverID, probeInterval time.Duration) *FailoverDriver {
+	d := &FailoverDriver{
+		probeInterval: probeInterval,
+		maxReplay:     defaultFailoverMaxReplay,
+		now:           time.Now,
+		done:          make(chan struct{}),
+	}
+	for i, driver := range children {
+		child := &failoverChild{id: ids[i], driver: driver}
+		d.children = append(d.children, child)
+		setErrorHandler(driver, func(err error) {
+			d.childFailed(child, err)
+		})
+	}
+
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+// Log writes the record to the active child, then to the next usable ones as long as the write
+// reports an error
+func (d *FailoverDriver) Log(data map[Param]string) {
+	queued := false
+	var tried []*failoverChild
+	for {
+		d.mutex.Lock()
+		child := d.activeChild()
+		if slices.Contains(tried, child) {
+			d.mutex.Unlock()
+			return
+		}
+		if d.replay && child != d.children[0] && !queued {
+			d.queue(data)
+			queued = true
+		}
+		errors := child.errors
+		d.mutex.Unlock()
+
+		// Not under the mutex; the child may report an error synchronously
+		child.driver.Log(data)
+
+		d.mutex.Lock()
+		failed := child.errors != errors
+		d.mutex.Unlock()
+		if !failed {
+			return
+		}
+		tried = append(tried, child)
+	}
+}
+
+// queue adds a record to replay, dropping the oldest one when full; called under the mutex
+func (d *FailoverDriver) queue(data map[Param]string) {
+	if len(d.pending) >= d.maxReplay {
+		d.pending = d.pending[1:]
+	}
+	d.pending = append(d.pending, data)
+}
+
+// activeChild returns the first usable child, the last child if none is
+func (d *FailoverDriver) activeChild() *failoverChild {
+	for _, child := range d.children {
+		if !child.failedAt.IsZero() {
+			continue
+		}
+		if err := driverHealth(child.driver); err != nil {
+			child.failedAt = d.now()
+			continue
+		}
+		return child
+	}
+	return d.children[len(d.children)-1]
+}
+
+func (d *FailoverDriver) childFailed(child *failoverChild, err error) {
+	d.mutex.Lock()
+	child.errors++
+	if child.failedAt.IsZero() {
+		child.failedAt = d.now()
+	}
+	d.mutex.Unlock()
+
+	d.reportError(fmt.Errorf("failover: %s: %w", child.id, err))
+}
+
+func (d *FailoverDriver) BeginTx(id TxID, attr map[Param]string) {
+	for _, child := range d.children {
+		child.driver.BeginTx(id, attr)
+	}
+}
+
+func (d *FailoverDriver) EndTx(id TxID) {
+	for _, child := range d.children {
+		child.driver.EndTx(id)
+	}
+}
+
+func (d *FailoverDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	for _, child := range d.children {
+		endTxWithStatus(child.driver, id, status)
+	}
+}
+
+func (d *FailoverDriver) Flush() {
+	for _, child := range d.children {
+		flushDriver(child.driver)
+	}
+}
+
+func (d *FailoverDriver) Dump() {
+	for _, child := range d.children {
+		dumpDriver(child.driver)
+	}
+}
+
+// Health fails while the records don't go to the primary
+func (d *FailoverDriver) Health() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	primary := d.children[0]
+	if active := d.activeChild(); active != primary {
+		return fmt.Errorf("failover: %s failed, writing to %s", primary.id, active.id)
+	}
+	return nil
+}
+
+// ReportsErrorsAsync is true if any child reports its errors asynchronously
+func (d *FailoverDriver) ReportsErrorsAsync() bool {
+	for _, child := range d.children {
+		if reportsErrorsAsync(child.driver) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop stops the children; later calls do nothing
+func (d *FailoverDriver) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+		d.wg.Wait()
+		for _, child := range d.children {
+			child.driver.Stop()
+		}
+	})
+}
+
+func (d *FailoverDriver) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(max(d.probeInterval/4, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.probe()
+		}
+	}
+}
+
+// probe makes the children failed for longer than the probe interval usable again if their
+// health check passes. The primary is replayed the pending records first: it stays failed
+// meanwhile, so that the records logged during the replay go to the fallback and are queued
+// behind the replayed ones. A record failing to replay is queued again with the following ones
+func (d *FailoverDriver) probe() {
+	d.mutex.Lock()
+	now := d.now()
+	primary := d.children[0]
+	for _, child := range d.children {
+		if child.failedAt.IsZero() || now.Sub(child.failedAt) < d.probeInterval {
+			continue
+		}
+		if driverHealth(child.driver) == nil && (child != primary || len(d.pending) == 0) {
+			child.failedAt = time.Time{}
+		}
+	}
+	recovering := !primary.failedAt.IsZero() && now.Sub(primary.failedAt) >= d.probeInterval &&
+		driverHealth(primary.driver) == nil
+	d.mutex.Unlock()
+
+	for recovering {
+		d.mutex.Lock()
+		replay := d.pending
+		d.pending = nil
+		if len(replay) == 0 {
+			primary.failedAt = time.Time{}
+			d.mutex.Unlock()
+			return
+		}
+		d.mutex.Unlock()
+
+		for i, data := range replay {
+			d.mutex.Lock()
+			errors := primary.errors
+			d.mutex.Unlock()
+
+			primary.driver.Log(data)
+
+			d.mutex.Lock()
+			if primary.errors != errors {
+				// Ahead of the records queued during the replay
+				d.pending = append(replay[i:], d.pending...)
+				if len(d.pending) > d.maxReplay {
+					d.pending = d.pending[len(d.pending)-d.maxReplay:]
+				}
+				primary.failedAt = d.now()
+				d.mutex.Unlock()
+				return
+			}
+			d.mutex.Unlock()
+		}
+	}
+}
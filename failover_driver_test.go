@@ -0,0 +1,194 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// FlakyDriver records the records while up and reports an error for each while down
+type FlakyDriver struct {
+	RecordingDriver
+	errorReporter
+	down   atomic.Bool
+	health atomic.Pointer[error]
+}
+
+func (d *FlakyDriver) Log(data map[Param]string) {
+	if d.down.Load() {
+		d.reportError(errors.New("sink down"))
+		return
+	}
+	d.RecordingDriver.Log(data)
+}
+
+func (d *FlakyDriver) Health() error {
+	if err := d.health.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func newTestFailoverDriver(children ...DriverInterface) (*FailoverDriver, *time.Time) {
+	d := NewFailoverDriver(children, time.Hour)
+	now := time.Unix(1000, 0)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+func TestFailoverDriver_FailsOverOnErrors(t *testing.T) {
+	primary := &FlakyDriver{}
+	fallback := &RecordingDriver{}
+	drv, now := newTestFailoverDriver(primary, fallback)
+	drv.replay = true
+	var reported []error
+	drv.SetErrorHandler(func(err error) {
+		reported = append(reported, err)
+	})
+
+	drv.Log(map[Param]string{MessageParam: "a"})
+	primary.down.Store(true)
+	// Written to the fallback once the primary reported its failure
+	drv.Log(map[Param]string{MessageParam: "b"})
+	drv.Log(map[Param]string{MessageParam: "c"})
+	require.EqualError(t, drv.Health(), "failover: #0 failed, writing to #1")
+
+	// Not retried before the probe interval elapses
+	primary.down.Store(false)
+	drv.probe()
+	drv.Log(map[Param]string{MessageParam: "d"})
+
+	*now = now.Add(time.Hour)
+	drv.probe()
+	drv.Log(map[Param]string{MessageParam: "e"})
+	require.NoError(t, drv.Health())
+	drv.Stop()
+	drv.Stop()
+
+	require.Equal(t, []string{"a", "b", "c", "d", "e"}, messages(primary.Records()))
+	require.Equal(t, []string{"b", "c", "d"}, messages(fallback.Records()))
+	require.Len(t, reported, 1)
+	require.EqualError(t, reported[0], "failover: #0: sink down")
+	require.True(t, primary.stopped)
+	require.True(t, fallback.stopped)
+}
+
+func TestFailoverDriver_ReplayFails(t *testing.T) {
+	primary := &FlakyDriver{}
+	fallback := &RecordingDriver{}
+	drv, now := newTestFailoverDriver(primary, fallback)
+	defer drv.Stop()
+	drv.replay = true
+	drv.SetErrorHandler(func(error) {})
+
+	primary.down.Store(true)
+	drv.Log(map[Param]string{MessageParam: "a"})
+	drv.Log(map[Param]string{MessageParam: "b"})
+
+	// The health check passes but the replay fails: the records stay queued and the primary failed
+	*now = now.Add(time.Hour)
+	drv.probe()
+	drv.Log(map[Param]string{MessageParam: "c"})
+	require.Error(t, drv.Health())
+
+	// The probe interval starts again at the failed replay
+	primary.down.Store(false)
+	drv.probe()
+	require.Empty(t, primary.Records())
+	*now = now.Add(time.Hour)
+	drv.probe()
+	drv.Log(map[Param]string{MessageParam: "d"})
+
+	require.NoError(t, drv.Health())
+	require.Equal(t, []string{"a", "b", "c", "d"}, messages(primary.Records()))
+	require.Equal(t, []string{"a", "b", "c"}, messages(fallback.Records()))
+	require.Empty(t, drv.pending)
+}
+
+func TestFailoverDriver_HealthCheck(t *testing.T) {
+	primary := &FlakyDriver{}
+	secondary := &FlakyDriver{}
+	fallback := &RecordingDriver{}
+	drv, now := newTestFailoverDriver(primary, secondary, fallback)
+	defer drv.Stop()
+
+	unhealthy := errors.New("disconnected")
+	primary.health.Store(&unhealthy)
+	drv.BeginTx(1, nil)
+	drv.Log(map[Param]string{MessageParam: "a"})
+
+	// Still unhealthy after the probe interval
+	*now = now.Add(time.Hour)
+	drv.probe()
+	drv.Log(map[Param]string{MessageParam: "b"})
+
+	primary.health.Store(nil)
+	*now = now.Add(time.Hour)
+	drv.probe()
+	drv.Log(map[Param]string{MessageParam: "c"})
+	drv.EndTxWithStatus(1, TxFailed)
+
+	require.Equal(t, []string{"c"}, messages(primary.Records()))
+	require.Equal(t, []string{"a", "b"}, messages(secondary.Records()))
+	require.Empty(t, fallback.Records())
+	// Every child knows the transaction
+	for _, child := range []*RecordingDriver{&primary.RecordingDriver, &secondary.RecordingDriver, fallback} {
+		require.Equal(t, []TxID{1}, child.begins)
+		require.Equal(t, TxFailed, child.Status(1))
+	}
+}
+
+func TestFailoverDriver_AllChildrenFailed(t *testing.T) {
+	primary := &FlakyDriver{}
+	fallback := &FlakyDriver{}
+	drv, _ := newTestFailoverDriver(primary, fallback)
+	defer drv.Stop()
+	drv.SetErrorHandler(func(error) {})
+
+	primary.down.Store(true)
+	fallback.down.Store(true)
+	drv.Log(map[Param]string{MessageParam: "a"})
+	drv.Log(map[Param]string{MessageParam: "b"})
+	fallback.down.Store(false)
+	// The last child gets the records when no child is usable
+	drv.Log(map[Param]string{MessageParam: "c"})
+
+	require.Empty(t, primary.Records())
+	require.Equal(t, []string{"c"}, messages(fallback.Records()))
+}
+
+func TestFailoverDriverFactory(t *testing.T) {
+	dir := t.TempDir()
+	factory := NewFailoverDriverFactory(&FileDriverFactory{}, &ConsoleDriverFactory{})
+	require.Equal(t, DriverID("failover"), factory.DriverID())
+
+	drv, err := factory.CreateDriver(json.RawMessage(`{"probeIntervalMs":100,"replay":true,"maxReplay":5,"drivers":[
+		{"file:primary":{"filePath":"` + filepath.Join(dir, "primary.log") + `"}},
+		{"fallback":{"type":"file","filePath":"` + filepath.Join(dir, "fallback.log") + `"}},
+		{"console":{}}
+	]}`))
+	require.NoError(t, err)
+	failover := drv.(*FailoverDriver)
+	require.Len(t, failover.children, 3)
+	require.Equal(t, DriverID("file:primary"), failover.children[0].id)
+	require.Equal(t, DriverID("fallback"), failover.children[1].id)
+	require.Equal(t, 100*time.Millisecond, failover.probeInterval)
+	require.True(t, failover.replay)
+	require.Equal(t, 5, failover.maxReplay)
+	drv.Stop()
+
+	for _, config := range []string{
+		`{"drivers":[{"console":{}}]}`,
+		`{"drivers":[{"console":{}},{"syslog":{}}]}`,
+		`{"drivers":[{"console":{}},{"console":{},"file":{}}]}`,
+		`{"drivers":[{"console":{}},{"file":{"filePath":"` + dir + `"}}]}`,
+	} {
+		_, err = factory.CreateDriver(json.RawMessage(config))
+		require.Error(t, err, config)
+	}
+}
@@ -11,6 +11,7 @@ const FileDriverID = "file"
 type fileConfig struct {
 	UserReadableTime bool   `json:"userReadableTime"`
 	FilePath         string `json:"filePath"`
+	Format           string `json:"format"` // "text" (default), "json" or "binary"
 }
 
 // FileDriverFactory implements DriverFactoryInterface
@@ -41,16 +42,33 @@ func (f *FileDriverFactory) CreateDriver(config json.RawMessage) (DriverInterfac
 
 // FileDriver implements DriverInterface
 type FileDriver struct {
+	errorReporter
+
 	config fileConfig
 	file   *os.File
 }
 
 func (d *FileDriver) Log(data map[Param]string) {
-	line := formatLine(data, d.config.UserReadableTime)
-	d.file.WriteString(line + "\n")
+	if d.config.Format == BinaryFormat {
+		d.write(wireFrame(WireEvent{Type: WireRecord, Params: data}))
+		return
+	}
+	line := formatRecord(data, d.config.Format, d.config.UserReadableTime)
+	d.write([]byte(line + "\n"))
+}
+
+func (d *FileDriver) write(data []byte) {
+	_, err := d.file.Write(data)
+	if err != nil {
+		d.reportError(fmt.Errorf("failed to write to log file %s: %w", d.config.FilePath, err))
+	}
 }
 
 func (d *FileDriver) BeginTx(id TxID, attr map[Param]string) {
+	if d.config.Format == BinaryFormat {
+		d.write(wireFrame(WireEvent{Type: WireTxBegin, TxID: id, Params: attr}))
+		return
+	}
 	txData := make(map[Param]string)
 	txData[TxIDParam] = id.String()
 	message := fmt.Sprintf("TX Begin; Params: %v", attr)
@@ -60,6 +78,10 @@ func (d *FileDriver) BeginTx(id TxID, attr map[Param]string) {
 }
 
 func (d *FileDriver) EndTx(id TxID) {
+	if d.config.Format == BinaryFormat {
+		d.write(wireFrame(WireEvent{Type: WireTxEnd, TxID: id}))
+		return
+	}
 	txData := make(map[Param]string)
 	txData[TxIDParam] = id.String()
 	txData[MessageParam] = "TX End"
@@ -67,6 +89,32 @@ func (d *FileDriver) EndTx(id TxID) {
 	d.Log(txData)
 }
 
+func (d *FileDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	if d.config.Format == BinaryFormat {
+		d.write(wireFrame(WireEvent{Type: WireTxEnd, TxID: id, Params: map[Param]string{TxStatusParam: string(status)}}))
+		return
+	}
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+}
+
+func (d *FileDriver) Flush() {
+	if d.file == nil {
+		return
+	}
+	err := d.file.Sync()
+	if err != nil {
+		d.reportError(fmt.Errorf("failed to sync log file %s: %w", d.config.FilePath, err))
+	}
+}
+
 func (d *FileDriver) Stop() {
 	if d.file != nil {
 		d.file.Close()
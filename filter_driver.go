@@ -0,0 +1,110 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// withFilter wraps the driver by FilterDriver when its config has a "filter" block
+func withFilter(driver DriverInterface, config json.RawMessage) (DriverInterface, error) {
+	var wrapper struct {
+		Filter *RecordFilter `json:"filter"`
+	}
+	// Drivers accept configs that aren't objects; those have no filter
+	if json.Unmarshal(config, &wrapper) != nil || wrapper.Filter == nil {
+		return driver, nil
+	}
+
+	d, err := NewFilterDriver(driver, *wrapper.Filter)
+	if err != nil {
+		driver.Stop()
+		return nil, fmt.Errorf("invalid filter config: %w", err)
+	}
+	return d, nil
+}
+
+// FilterDriver implements DriverInterface
+// It forwards the records matching the filter only. Transaction begin and end events are always
+// forwarded
+type FilterDriver struct {
+	provider DriverInterface
+	matcher  *recordMatcher
+
+	mutex   sync.Mutex
+	txAttrs map[string]map[Param]string // attributes of the open transactions, if the filter uses them
+}
+
+func NewFilterDriver(provider DriverInterface, filter RecordFilter) (*FilterDriver, error) {
+	matcher, err := newRecordMatcher(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterDriver{
+		provider: provider,
+		matcher:  matcher,
+		txAttrs:  make(map[string]map[Param]string),
+	}, nil
+}
+
+func (d *FilterDriver) Log(data map[Param]string) {
+	var txAttr map[Param]string
+	if len(d.matcher.filter.TxAttr) > 0 {
+		d.mutex.Lock()
+		txAttr = d.txAttrs[data[TxIDParam]]
+		d.mutex.Unlock()
+	}
+	if d.matcher.matches(data, txAttr) {
+		d.provider.Log(data)
+	}
+}
+
+func (d *FilterDriver) BeginTx(id TxID, attr map[Param]string) {
+	if len(d.matcher.filter.TxAttr) > 0 {
+		d.mutex.Lock()
+		d.txAttrs[id.String()] = attr
+		d.mutex.Unlock()
+	}
+	d.provider.BeginTx(id, attr)
+}
+
+func (d *FilterDriver) EndTx(id TxID) {
+	d.forgetTx(id)
+	d.provider.EndTx(id)
+}
+
+func (d *FilterDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	d.forgetTx(id)
+	endTxWithStatus(d.provider, id, status)
+}
+
+func (d *FilterDriver) forgetTx(id TxID) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.txAttrs, id.String())
+}
+
+func (d *FilterDriver) Flush() {
+	flushDriver(d.provider)
+}
+
+func (d *FilterDriver) Dump() {
+	dumpDriver(d.provider)
+}
+
+func (d *FilterDriver) SetErrorHandler(handler func(err error)) {
+	setErrorHandler(d.provider, handler)
+}
+
+func (d *FilterDriver) Health() error {
+	return driverHealth(d.provider)
+}
+
+// ReportsErrorsAsync is the one of the wrapped driver
+func (d *FilterDriver) ReportsErrorsAsync() bool {
+	return reportsErrorsAsync(d.provider)
+}
+
+func (d *FilterDriver) Stop() {
+	d.provider.Stop()
+}
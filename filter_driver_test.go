@@ -0,0 +1,44 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterDriver_TxAttr(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv, err := NewFilterDriver(provider, RecordFilter{
+		Levels: []LogLevel{Warn, Error},
+		TxAttr: map[Param]string{"tenant": "acme"},
+	})
+	require.NoError(t, err)
+
+	drv.BeginTx(1, map[Param]string{"tenant": "acme"})
+	drv.BeginTx(2, map[Param]string{"tenant": "globex"})
+	drv.Log(map[Param]string{MessageParam: "acme info", LevelParam: string(Info), TxIDParam: "1"})
+	drv.Log(map[Param]string{MessageParam: "acme warn", LevelParam: string(Warn), TxIDParam: "1"})
+	drv.Log(map[Param]string{MessageParam: "globex warn", LevelParam: string(Warn), TxIDParam: "2"})
+	drv.Log(map[Param]string{MessageParam: "no tx", LevelParam: string(Error)})
+	drv.EndTxWithStatus(1, TxFailed)
+	drv.EndTx(2)
+	drv.Stop()
+
+	require.Equal(t, []string{"acme warn"}, messages(provider.Records()))
+	require.Equal(t, []TxID{1, 2}, provider.begins)
+	require.Equal(t, TxFailed, provider.Status(1))
+	require.Empty(t, drv.txAttrs)
+	require.True(t, provider.stopped)
+}
+
+func TestFilterDriver_InvalidConfig(t *testing.T) {
+	drv := &RecordingDriver{}
+	_, err := withFilter(drv, json.RawMessage(`{"filter":{"message":"("}}`))
+	require.Error(t, err)
+	require.True(t, drv.stopped)
+
+	unfiltered, err := withFilter(drv, json.RawMessage(`{"filePath":"app.log"}`))
+	require.NoError(t, err)
+	require.Same(t, drv, unfiltered)
+}
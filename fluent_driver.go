@@ -0,0 +1,316 @@
+package logsystem
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const FluentDriverID = "fluent"
+
+const (
+	FluentForwardMode       = "forward"
+	FluentPackedForwardMode = "packedForward"
+)
+
+const (
+	defaultFluentAddress    = "127.0.0.1:24224"
+	defaultFluentTag        = "logsystem.{component}"
+	defaultFluentAckTimeout = 5 * time.Second
+	// Enough retries with the doubling backoff to ride out a restart of the sidecar
+	defaultFluentMaxRetries = 8
+	fluentDialTimeout       = 5 * time.Second
+	fluentEmptyTagPart      = "default"
+)
+
+type fluentConfig struct {
+	batchConfig // pending records are the buffer kept while the sidecar is unavailable
+
+	Network      string `json:"network"`      // tcp (default) or unix
+	Address      string `json:"address"`      // defaults to 127.0.0.1:24224
+	Tag          string `json:"tag"`          // {component} and {level} are replaced; default logsystem.{component}
+	Mode         string `json:"mode"`         // forward (default) or packedForward
+	RequireAck   bool   `json:"requireAck"`   // at-least-once delivery using the chunk option
+	AckTimeoutMs int    `json:"ackTimeoutMs"` // default 5000
+}
+
+// FluentDriverFactory implements DriverFactoryInterface
+type FluentDriverFactory struct {
+}
+
+func (f *FluentDriverFactory) DriverID() DriverID {
+	return DriverID(FluentDriverID)
+}
+
+func (f *FluentDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var fluentConfig fluentConfig
+	err := json.Unmarshal(config, &fluentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fluent driver config: %w", err)
+	}
+
+	if fluentConfig.Network == "" {
+		fluentConfig.Network = "tcp"
+	}
+	if fluentConfig.Network != "tcp" && fluentConfig.Network != "unix" {
+		return nil, fmt.Errorf("unknown fluent network: %s", fluentConfig.Network)
+	}
+	if fluentConfig.Address == "" {
+		fluentConfig.Address = defaultFluentAddress
+	}
+	if fluentConfig.Tag == "" {
+		fluentConfig.Tag = defaultFluentTag
+	}
+	switch fluentConfig.Mode {
+	case "":
+		fluentConfig.Mode = FluentForwardMode
+	case FluentForwardMode, FluentPackedForwardMode:
+	default:
+		return nil, fmt.Errorf("unknown fluent mode: %s", fluentConfig.Mode)
+	}
+	if fluentConfig.MaxRetries == 0 {
+		fluentConfig.MaxRetries = defaultFluentMaxRetries
+	}
+
+	d := &FluentDriver{
+		config:     fluentConfig,
+		ackTimeout: defaultFluentAckTimeout,
+	}
+	if fluentConfig.AckTimeoutMs > 0 {
+		d.ackTimeout = time.Duration(fluentConfig.AckTimeoutMs) * time.Millisecond
+	}
+	d.batcher = newBatcher("fluent", fluentConfig.batchConfig, d.forward, &d.errorReporter)
+	return d, nil
+}
+
+type fluentEntry struct {
+	tag    string
+	time   time.Time
+	record map[Param]string
+}
+
+// FluentDriver implements DriverInterface
+// It sends the records to fluentd/fluent-bit using the Forward protocol. The connection is
+// (re)established on demand; unacknowledged records are resent
+type FluentDriver struct {
+	errorReporter
+
+	config     fluentConfig
+	ackTimeout time.Duration
+	batcher    *batcher[fluentEntry]
+
+	// only used from the batcher goroutine
+	conn net.Conn
+}
+
+func (d *FluentDriver) Log(data map[Param]string) {
+	d.batcher.add(fluentEntry{
+		tag:    d.tag(data),
+		time:   recordTime(data),
+		record: data,
+	})
+}
+
+func (d *FluentDriver) BeginTx(id TxID, attr map[Param]string) {
+	txData := make(map[Param]string)
+	for k, v := range attr {
+		txData[k] = v
+	}
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX Begin"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *FluentDriver) EndTx(id TxID) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *FluentDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+}
+
+func (d *FluentDriver) Flush() {
+	d.batcher.flush()
+}
+
+// ReportsErrorsAsync is true: the records are sent in batches
+func (d *FluentDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+func (d *FluentDriver) Stop() {
+	d.batcher.stop()
+	d.closeConn()
+}
+
+func (d *FluentDriver) tag(data map[Param]string) string {
+	part := func(param Param) string {
+		if val := data[param]; val != "" {
+			return val
+		}
+		return fluentEmptyTagPart
+	}
+	return strings.NewReplacer(
+		"{component}", part(ComponentParam),
+		"{level}", strings.ToLower(part(LevelParam)),
+	).Replace(d.config.Tag)
+}
+
+// forward sends one message per tag and returns the entries of the messages not delivered
+func (d *FluentDriver) forward(entries []fluentEntry) ([]fluentEntry, error) {
+	var tags []string
+	byTag := make(map[string][]fluentEntry)
+	for _, entry := range entries {
+		if _, ok := byTag[entry.tag]; !ok {
+			tags = append(tags, entry.tag)
+		}
+		byTag[entry.tag] = append(byTag[entry.tag], entry)
+	}
+
+	var retry []fluentEntry
+	var lastErr error
+	for _, tag := range tags {
+		err := d.sendMessage(tag, byTag[tag])
+		if err != nil {
+			d.closeConn()
+			retry = append(retry, byTag[tag]...)
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return retry, lastErr
+	}
+	return nil, nil
+}
+
+func (d *FluentDriver) sendMessage(tag string, entries []fluentEntry) error {
+	if d.conn == nil {
+		conn, err := net.DialTimeout(d.config.Network, d.config.Address, fluentDialTimeout)
+		if err != nil {
+			return err
+		}
+		d.conn = conn
+	}
+
+	chunk := ""
+	if d.config.RequireAck {
+		var id [16]byte
+		_, err := rand.Read(id[:])
+		if err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+
+	message := d.encodeMessage(tag, entries, chunk)
+	_, err := d.conn.Write(message)
+	if err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	return d.waitAck(chunk)
+}
+
+// encodeMessage encodes [tag, entries, option]; entries are an array of [time, record] in Forward
+// mode and their concatenation as binary in PackedForward mode
+func (d *FluentDriver) encodeMessage(tag string, entries []fluentEntry, chunk string) []byte {
+	var b []byte
+	b = msgpackAppendArrayHeader(b, 3)
+	b = msgpackAppendString(b, tag)
+
+	if d.config.Mode == FluentPackedForwardMode {
+		var packed []byte
+		for _, entry := range entries {
+			packed = appendFluentEntry(packed, entry)
+		}
+		b = msgpackAppendBinary(b, packed)
+	} else {
+		b = msgpackAppendArrayHeader(b, len(entries))
+		for _, entry := range entries {
+			b = appendFluentEntry(b, entry)
+		}
+	}
+
+	options := 1
+	if chunk != "" {
+		options++
+	}
+	b = msgpackAppendMapHeader(b, options)
+	b = msgpackAppendString(b, "size")
+	b = msgpackAppendUint(b, uint64(len(entries)))
+	if chunk != "" {
+		b = msgpackAppendString(b, "chunk")
+		b = msgpackAppendString(b, chunk)
+	}
+	return b
+}
+
+func appendFluentEntry(b []byte, entry fluentEntry) []byte {
+	b = msgpackAppendArrayHeader(b, 2)
+	b = msgpackAppendEventTime(b, entry.time)
+	b = msgpackAppendMapHeader(b, len(entry.record))
+	for k, v := range entry.record {
+		b = msgpackAppendString(b, string(k))
+		b = msgpackAppendString(b, v)
+	}
+	return b
+}
+
+// waitAck reads the {"ack": chunk} response
+func (d *FluentDriver) waitAck(chunk string) error {
+	err := d.conn.SetReadDeadline(time.Now().Add(d.ackTimeout))
+	if err != nil {
+		return err
+	}
+	defer d.conn.SetReadDeadline(time.Time{})
+
+	var data []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := d.conn.Read(buf)
+		if err != nil {
+			return fmt.Errorf("failed to read fluent ack: %w", err)
+		}
+		data = append(data, buf[:n]...)
+
+		value, _, err := msgpackDecode(data)
+		if errors.Is(err, errMsgpackShort) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid fluent ack: %w", err)
+		}
+		response, ok := value.(map[string]any)
+		if !ok || response["ack"] != chunk {
+			return fmt.Errorf("unexpected fluent ack: %v", value)
+		}
+		return nil
+	}
+}
+
+func (d *FluentDriver) closeConn() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
@@ -0,0 +1,124 @@
+package logsystem
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readFluentMessage reads one msgpack value from the connection
+func readFluentMessage(t *testing.T, conn net.Conn) []any {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		data = append(data, buf[:n]...)
+		value, rest, err := msgpackDecode(data)
+		if errors.Is(err, errMsgpackShort) {
+			continue
+		}
+		require.NoError(t, err)
+		require.Empty(t, rest)
+		message, ok := value.([]any)
+		require.True(t, ok)
+		require.Len(t, message, 3)
+		return message
+	}
+}
+
+func decodeFluentEntry(t *testing.T, entry any) (time.Time, map[string]any) {
+	pair, ok := entry.([]any)
+	require.True(t, ok)
+	ext, ok := pair[0].(msgpackExt)
+	require.True(t, ok)
+	require.Equal(t, int8(0), ext.Type)
+	ts := time.Unix(int64(binary.BigEndian.Uint32(ext.Data[:4])), int64(binary.BigEndian.Uint32(ext.Data[4:])))
+	record, ok := pair[1].(map[string]any)
+	require.True(t, ok)
+	return ts, record
+}
+
+func TestFluentDriver_ForwardWithAckSurvivesRestart(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv, err := (&FluentDriverFactory{}).CreateDriver(json.RawMessage(`{
+		"address": "` + listener.Addr().String() + `",
+		"tag": "app.{component}",
+		"requireAck": true,
+		"ackTimeoutMs": 500,
+		"retryBackoffMs": 1,
+		"flushIntervalMs": 10
+	}`))
+	require.NoError(t, err)
+	defer drv.Stop()
+
+	drv.Log(map[Param]string{MessageParam: "hello", LevelParam: "info", TimeParam: "1700000000", ComponentParam: "db"})
+
+	// The first connection goes away before acknowledging, as during a sidecar restart
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	readFluentMessage(t, conn)
+	conn.Close()
+
+	conn, err = listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	message := readFluentMessage(t, conn)
+
+	require.Equal(t, "app.db", message[0])
+	entries, ok := message[1].([]any)
+	require.True(t, ok)
+	require.Len(t, entries, 1)
+	ts, record := decodeFluentEntry(t, entries[0])
+	require.Equal(t, int64(1700000000), ts.Unix())
+	require.Equal(t, map[string]any{"message": "hello", "level": "info", "time": "1700000000", "component": "db"}, record)
+
+	options, ok := message[2].(map[string]any)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), options["size"])
+	chunk, ok := options["chunk"].(string)
+	require.True(t, ok)
+	ack := msgpackAppendString(msgpackAppendString(msgpackAppendMapHeader(nil, 1), "ack"), chunk)
+	_, err = conn.Write(ack)
+	require.NoError(t, err)
+}
+
+func TestFluentDriver_PackedForward(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv, err := (&FluentDriverFactory{}).CreateDriver(json.RawMessage(`{"address":"` + listener.Addr().String() + `","mode":"packedForward"}`))
+	require.NoError(t, err)
+
+	drv.Log(map[Param]string{MessageParam: "one"})
+	drv.Log(map[Param]string{MessageParam: "two"})
+	drv.Stop()
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	message := readFluentMessage(t, conn)
+	require.Equal(t, "logsystem.default", message[0])
+
+	packed, ok := message[1].([]byte)
+	require.True(t, ok)
+	var messages []any
+	for len(packed) > 0 {
+		var entry any
+		entry, packed, err = msgpackDecode(packed)
+		require.NoError(t, err)
+		_, record := decodeFluentEntry(t, entry)
+		messages = append(messages, record["message"])
+	}
+	require.Equal(t, []any{"one", "two"}, messages)
+}
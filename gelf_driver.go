@@ -0,0 +1,289 @@
+package logsystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const GELFDriverID = "gelf"
+
+const (
+	GELFGzipCompression = "gzip"
+	GELFZlibCompression = "zlib"
+	GELFNoCompression   = "none"
+)
+
+const (
+	defaultGELFAddress   = "127.0.0.1:12201"
+	defaultGELFChunkSize = 1420
+	gelfMaxChunkSize     = 8192
+	gelfMaxChunks        = 128
+	gelfChunkHeaderSize  = 12
+	gelfDialTimeout      = 5 * time.Second
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+type gelfConfig struct {
+	Network     string `json:"network"`     // udp (default) or tcp
+	Address     string `json:"address"`     // defaults to 127.0.0.1:12201
+	Compression string `json:"compression"` // udp only: gzip (default), zlib or none
+	ChunkSize   int    `json:"chunkSize"`   // udp datagram size, chunk header included; default 1420
+	Host        string `json:"host"`        // defaults to os.Hostname
+}
+
+// GELFDriverFactory implements DriverFactoryInterface
+type GELFDriverFactory struct {
+}
+
+func (f *GELFDriverFactory) DriverID() DriverID {
+	return DriverID(GELFDriverID)
+}
+
+func (f *GELFDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var gelfConfig gelfConfig
+	err := json.Unmarshal(config, &gelfConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal gelf driver config: %w", err)
+	}
+
+	if gelfConfig.Network == "" {
+		gelfConfig.Network = "udp"
+	}
+	if gelfConfig.Address == "" {
+		gelfConfig.Address = defaultGELFAddress
+	}
+	if gelfConfig.Host == "" {
+		gelfConfig.Host, _ = os.Hostname()
+	}
+	switch gelfConfig.Network {
+	case "udp":
+		if gelfConfig.Compression == "" {
+			gelfConfig.Compression = GELFGzipCompression
+		}
+	case "tcp":
+		// GELF over TCP doesn't support compression
+		gelfConfig.Compression = GELFNoCompression
+	default:
+		return nil, fmt.Errorf("unknown gelf network: %s", gelfConfig.Network)
+	}
+	switch gelfConfig.Compression {
+	case GELFGzipCompression, GELFZlibCompression, GELFNoCompression:
+	default:
+		return nil, fmt.Errorf("unknown gelf compression: %s", gelfConfig.Compression)
+	}
+	if gelfConfig.ChunkSize == 0 {
+		gelfConfig.ChunkSize = defaultGELFChunkSize
+	}
+	if gelfConfig.ChunkSize <= gelfChunkHeaderSize || gelfConfig.ChunkSize > gelfMaxChunkSize {
+		return nil, fmt.Errorf("gelf chunk size must be between %d and %d", gelfChunkHeaderSize+1, gelfMaxChunkSize)
+	}
+
+	conn, err := net.DialTimeout(gelfConfig.Network, gelfConfig.Address, gelfDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to gelf %s %s: %w", gelfConfig.Network, gelfConfig.Address, err)
+	}
+
+	return NewSerialDriver(&GELFDriver{
+		config: gelfConfig,
+		conn:   conn,
+	}), nil
+}
+
+// GELFDriver implements DriverInterface
+// It sends GELF 1.1 messages; the params other than message, time and level are additional fields.
+// It isn't safe for concurrent use; the factory wraps it by SerialDriver
+type GELFDriver struct {
+	errorReporter
+
+	config gelfConfig
+	conn   net.Conn
+}
+
+func (d *GELFDriver) Log(data map[Param]string) {
+	payload, err := d.encodeMessage(data)
+	if err == nil {
+		err = d.send(payload)
+	}
+	if err != nil {
+		d.reportError(fmt.Errorf("failed to send gelf message: %w", err))
+	}
+}
+
+func (d *GELFDriver) BeginTx(id TxID, attr map[Param]string) {
+	txData := make(map[Param]string)
+	for k, v := range attr {
+		txData[k] = v
+	}
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX Begin"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *GELFDriver) EndTx(id TxID) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *GELFDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+}
+
+func (d *GELFDriver) Stop() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
+
+func (d *GELFDriver) encodeMessage(data map[Param]string) ([]byte, error) {
+	severity, ok := syslogSeverities[LogLevel(strings.ToLower(data[LevelParam]))]
+	if !ok {
+		severity = syslogSeverities[Info]
+	}
+
+	message := map[string]any{
+		"version":       "1.1",
+		"host":          d.config.Host,
+		"short_message": data[MessageParam],
+		"timestamp":     float64(recordTime(data).UnixMilli()) / 1000,
+		"level":         severity,
+	}
+	for k, v := range data {
+		switch k {
+		case MessageParam, TimeParam, LevelParam:
+			continue
+		case StackParam:
+			message["full_message"] = v
+			continue
+		}
+		if name := gelfFieldName(string(k)); name != "" {
+			message["_"+name] = v
+		}
+	}
+	if message["short_message"] == "" {
+		// short_message is mandatory and can't be empty
+		message["short_message"] = "-"
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return d.compress(payload)
+}
+
+// gelfFieldName keeps the characters allowed in additional field names: word characters, dots and dashes
+func gelfFieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || r == '.' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	// _id is reserved by Graylog
+	if name == "id" {
+		return "id_"
+	}
+	return name
+}
+
+func (d *GELFDriver) compress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch d.config.Compression {
+	case GELFGzipCompression:
+		zw = gzip.NewWriter(&buf)
+	case GELFZlibCompression:
+		zw = zlib.NewWriter(&buf)
+	default:
+		return payload, nil
+	}
+	_, err := zw.Write(payload)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	return buf.Bytes(), err
+}
+
+func (d *GELFDriver) send(payload []byte) error {
+	if d.config.Network == "tcp" {
+		frame := append(payload, 0)
+		err := d.write(frame)
+		if err != nil {
+			// The server may have closed the connection; reconnect once
+			d.Stop()
+			err = d.write(frame)
+		}
+		return err
+	}
+
+	if len(payload) <= d.config.ChunkSize {
+		return d.write(payload)
+	}
+	return d.sendChunked(payload)
+}
+
+// sendChunked splits the payload into datagrams prefixed with the chunk magic bytes, the
+// message ID, the sequence number and the sequence count
+func (d *GELFDriver) sendChunked(payload []byte) error {
+	dataSize := d.config.ChunkSize - gelfChunkHeaderSize
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return fmt.Errorf("message of %d bytes needs more than %d chunks", len(payload), gelfMaxChunks)
+	}
+
+	messageID := make([]byte, 8)
+	_, err := rand.Read(messageID)
+	if err != nil {
+		return err
+	}
+
+	for seq := 0; seq < count; seq++ {
+		end := min((seq+1)*dataSize, len(payload))
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-seq*dataSize)
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, messageID...)
+		chunk = append(chunk, byte(seq), byte(count))
+		chunk = append(chunk, payload[seq*dataSize:end]...)
+		err = d.write(chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *GELFDriver) write(b []byte) error {
+	if d.conn == nil {
+		conn, err := net.DialTimeout(d.config.Network, d.config.Address, gelfDialTimeout)
+		if err != nil {
+			return err
+		}
+		d.conn = conn
+	}
+	_, err := d.conn.Write(b)
+	return err
+}
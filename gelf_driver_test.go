@@ -0,0 +1,176 @@
+package logsystem
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createGELFDriver(t *testing.T, config string) DriverInterface {
+	drv, err := (&GELFDriverFactory{}).CreateDriver(json.RawMessage(config))
+	require.NoError(t, err)
+	t.Cleanup(drv.Stop)
+	return drv
+}
+
+func decodeGELF(t *testing.T, payload []byte) map[string]any {
+	var reader io.Reader = bytes.NewReader(payload)
+	var err error
+	switch {
+	case bytes.HasPrefix(payload, []byte{0x1f, 0x8b}):
+		reader, err = gzip.NewReader(reader)
+	case payload[0] == 0x78:
+		reader, err = zlib.NewReader(reader)
+	}
+	require.NoError(t, err)
+	var message map[string]any
+	require.NoError(t, json.NewDecoder(reader).Decode(&message))
+	return message
+}
+
+func TestGELFDriver_UDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createGELFDriver(t, `{"address":"`+listener.LocalAddr().String()+`","host":"host"}`)
+	drv.Log(map[Param]string{
+		MessageParam:   "disk almost full",
+		LevelParam:     string(Warn),
+		TimeParam:      "1700000000",
+		TxIDParam:      "7",
+		ComponentParam: "storage",
+		"id":           "reserved",
+		"user name":    "bob",
+	})
+
+	message := decodeGELF(t, []byte(readDatagram(t, listener)))
+	require.Equal(t, "1.1", message["version"])
+	require.Equal(t, "host", message["host"])
+	require.Equal(t, "disk almost full", message["short_message"])
+	require.Equal(t, float64(1700000000), message["timestamp"])
+	require.Equal(t, float64(4), message["level"])
+	require.Equal(t, "7", message["_txID"])
+	require.Equal(t, "storage", message["_component"])
+	require.Equal(t, "reserved", message["_id_"])
+	require.Equal(t, "bob", message["_user_name"])
+	require.NotContains(t, message, "_id")
+}
+
+func TestGELFDriver_Chunking(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createGELFDriver(t, `{"address":"`+listener.LocalAddr().String()+`","compression":"none","chunkSize":100}`)
+	long := strings.Repeat("0123456789", 50)
+	drv.Log(map[Param]string{MessageParam: long, LevelParam: string(Error), StackParam: "main.main\n\tmain.go:1"})
+
+	chunks := map[byte][]byte{}
+	var messageID []byte
+	var count byte
+	for {
+		chunk := []byte(readDatagram(t, listener))
+		require.LessOrEqual(t, len(chunk), 100)
+		require.Equal(t, gelfChunkMagic, chunk[:2])
+		if messageID == nil {
+			messageID = chunk[2:10]
+			count = chunk[11]
+		}
+		require.Equal(t, messageID, chunk[2:10])
+		require.Equal(t, count, chunk[11])
+		chunks[chunk[10]] = chunk[12:]
+		if len(chunks) == int(count) {
+			break
+		}
+	}
+	require.Greater(t, int(count), 1)
+
+	var payload []byte
+	for seq := byte(0); seq < count; seq++ {
+		payload = append(payload, chunks[seq]...)
+	}
+	message := decodeGELF(t, payload)
+	require.Equal(t, long, message["short_message"])
+	require.Equal(t, "main.main\n\tmain.go:1", message["full_message"])
+	require.Equal(t, float64(3), message["level"])
+}
+
+func TestGELFDriver_TooManyChunks(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createGELFDriver(t, `{"address":"`+listener.LocalAddr().String()+`","compression":"none","chunkSize":13}`).(*SerialDriver).provider.(*GELFDriver)
+	payload, err := drv.encodeMessage(map[Param]string{MessageParam: strings.Repeat("x", 200)})
+	require.NoError(t, err)
+	require.ErrorContains(t, drv.send(payload), "128 chunks")
+}
+
+func TestGELFDriver_Zlib(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createGELFDriver(t, `{"address":"`+listener.LocalAddr().String()+`","compression":"zlib"}`)
+	drv.Log(map[Param]string{LevelParam: string(Debug)})
+
+	payload := []byte(readDatagram(t, listener))
+	require.Equal(t, byte(0x78), payload[0])
+	message := decodeGELF(t, payload)
+	require.Equal(t, "-", message["short_message"])
+	require.Equal(t, float64(7), message["level"])
+}
+
+func TestGELFDriver_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createGELFDriver(t, `{"network":"tcp","address":"`+listener.Addr().String()+`","compression":"gzip"}`)
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	drv.BeginTx(3, map[Param]string{"UserID": "123"})
+	endTxWithStatus(drv, 3, TxFailed)
+
+	reader := bufio.NewReader(conn)
+	readFrame := func() map[string]any {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		frame, err := reader.ReadBytes(0)
+		require.NoError(t, err)
+		// Compression is never used over TCP
+		return decodeGELF(t, frame[:len(frame)-1])
+	}
+
+	begin := readFrame()
+	require.Equal(t, "TX Begin", begin["short_message"])
+	require.Equal(t, "3", begin["_txID"])
+	require.Equal(t, "123", begin["_UserID"])
+
+	end := readFrame()
+	require.Equal(t, "failed", end["_txStatus"])
+	require.Equal(t, float64(3), end["level"])
+}
+
+func TestGELFDriverFactory_InvalidConfig(t *testing.T) {
+	for _, config := range []string{
+		`{"network":"unix"}`,
+		`{"compression":"lz4"}`,
+		`{"chunkSize":12}`,
+		`{"chunkSize":9000}`,
+	} {
+		_, err := (&GELFDriverFactory{}).CreateDriver(json.RawMessage(config))
+		require.Error(t, err, config)
+	}
+}
@@ -0,0 +1,90 @@
+package logsystem
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A driver is degraded for this long after reporting an error
+const defaultHealthWindow = time.Minute
+
+type HealthState string
+
+const (
+	Healthy  HealthState = "healthy"
+	Degraded HealthState = "degraded"
+)
+
+// DriverHealth is the health of one driver of the DriverManager
+type DriverHealth struct {
+	ID            DriverID
+	State         HealthState
+	Errors        int64     // errors reported since the driver was added
+	LastError     error     // last error reported
+	LastErrorTime time.Time // time of LastError; zero if no error was reported
+	HealthError   error     // failure of the driver's own health check, e.g. a lost connection
+}
+
+// Health is the health of the drivers of the DriverManager; degraded if any driver is
+type Health struct {
+	State   HealthState
+	Drivers []DriverHealth
+}
+
+// errorReporter is embedded by the drivers to implement ErrorReportingDriverInterface
+type errorReporter struct {
+	handler atomic.Pointer[func(err error)]
+}
+
+func (r *errorReporter) SetErrorHandler(handler func(err error)) {
+	r.handler.Store(&handler)
+}
+
+// reportError passes err to the handler, or prints it to stderr when the driver runs without one
+func (r *errorReporter) reportError(err error) {
+	if handler := r.handler.Load(); handler != nil && *handler != nil {
+		(*handler)(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Driver error: %v\n", err)
+}
+
+// driverErrors counts the errors reported by one driver of the manager
+type driverErrors struct {
+	mutex    sync.Mutex
+	count    int64
+	last     error
+	lastTime time.Time
+}
+
+func (e *driverErrors) add(err error, at time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.count++
+	e.last = err
+	e.lastTime = at
+}
+
+func (e *driverErrors) health(id DriverID, driver DriverInterface, now time.Time, window time.Duration) DriverHealth {
+	e.mutex.Lock()
+	h := DriverHealth{
+		ID:            id,
+		State:         Healthy,
+		Errors:        e.count,
+		LastError:     e.last,
+		LastErrorTime: e.lastTime,
+	}
+	e.mutex.Unlock()
+
+	if !h.LastErrorTime.IsZero() && now.Sub(h.LastErrorTime) < window {
+		h.State = Degraded
+	}
+	if err := driverHealth(driver); err != nil {
+		h.State = Degraded
+		h.HealthError = err
+	}
+	return h
+}
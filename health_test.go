@@ -0,0 +1,107 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// FailingDriver reports an error for each record; implements DriverInterface
+type FailingDriver struct {
+	RecordingDriver
+	errorReporter
+	health error
+}
+
+func (d *FailingDriver) Log(data map[Param]string) {
+	d.reportError(errors.New(data[MessageParam]))
+}
+
+func (d *FailingDriver) Health() error {
+	return d.health
+}
+
+func TestDriverManager_Health(t *testing.T) {
+	failing := &FailingDriver{}
+	m := NewManager()
+	m.AddNamedDriver("console", &RecordingDriver{})
+	// Reported through the proxies
+	m.AddNamedDriver("remote", NewSerialDriver(NewRedactDriver(failing, &Redactor{})))
+	now := time.Unix(1000, 0)
+	m.now = func() time.Time { return now }
+
+	var mutex sync.Mutex
+	var reported []string
+	m.SetErrorHandler(func(id DriverID, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported = append(reported, string(id)+": "+err.Error())
+	})
+
+	require.Equal(t, Health{
+		State: Healthy,
+		Drivers: []DriverHealth{
+			{ID: "console", State: Healthy},
+			{ID: "remote", State: Healthy},
+		},
+	}, m.Health())
+
+	m.log(map[Param]string{MessageParam: "timeout"})
+	m.log(map[Param]string{MessageParam: "refused"})
+	require.Equal(t, []string{"remote: timeout", "remote: refused"}, reported)
+
+	health := m.Health()
+	require.Equal(t, Degraded, health.State)
+	require.Equal(t, DriverHealth{ID: "console", State: Healthy}, health.Drivers[0])
+	require.Equal(t, DriverHealth{
+		ID:            "remote",
+		State:         Degraded,
+		Errors:        2,
+		LastError:     errors.New("refused"),
+		LastErrorTime: now,
+	}, health.Drivers[1])
+
+	// Healthy again once the errors are old enough, unless the driver's own check fails
+	now = now.Add(defaultHealthWindow)
+	require.Equal(t, Healthy, m.Health().State)
+	failing.health = errors.New("disconnected")
+	health = m.Health()
+	require.Equal(t, Degraded, health.State)
+	require.EqualError(t, health.Drivers[1].HealthError, "disconnected")
+	// The last reported error is kept with its own time
+	require.EqualError(t, health.Drivers[1].LastError, "refused")
+	require.Equal(t, now.Add(-defaultHealthWindow), health.Drivers[1].LastErrorTime)
+	require.EqualValues(t, 2, health.Drivers[1].Errors)
+}
+
+func TestDriverManager_FileAndSQLiteErrors(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{Drivers: map[DriverID]json.RawMessage{
+		"file":   json.RawMessage(`{"filePath":"` + filepath.Join(dir, "app.log") + `"}`),
+		"sqlite": json.RawMessage(`{"dbPath":"` + filepath.Join(dir, "logs.db") + `"}`),
+	}}
+	m, err := CreateLogManagerWithConfig([]DriverFactoryInterface{&FileDriverFactory{}, &DBDriverFactory{}}, config)
+	require.NoError(t, err)
+
+	errs := make(map[DriverID]error)
+	m.SetErrorHandler(func(id DriverID, err error) {
+		errs[id] = err
+	})
+
+	// Writing after the file and the database are closed fails
+	m.stop()
+	m.log(map[Param]string{MessageParam: "lost"})
+
+	require.ErrorContains(t, errs["file"], "failed to write to log file")
+	require.ErrorContains(t, errs["sqlite"], "failed to log to SQLite database")
+	health := m.Health()
+	require.Equal(t, Degraded, health.State)
+	for _, driver := range health.Drivers {
+		require.EqualValues(t, 1, driver.Errors)
+	}
+}
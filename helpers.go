@@ -1,7 +1,9 @@
 package logsystem
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +15,11 @@ type KnownParams struct {
 	Message   string
 	Component string
 	TxID      string
+	Error     string
+	File      string
+	Line      int
+	Function  string
+	Stack     string
 }
 
 func formatLine(data map[Param]string, userFriendly bool) string {
@@ -35,21 +42,106 @@ func formatLine(data map[Param]string, userFriendly bool) string {
 			optional = fmt.Sprintf("%s; TxID=[%s]", optional, p.TxID)
 		}
 	}
+	if p.Error != "" {
+		optional = fmt.Sprintf("%s; Err=[%s]", optional, p.Error)
+	}
+	if p.File != "" {
+		optional = fmt.Sprintf("%s; Src=[%s:%d]", optional, p.File, p.Line)
+	}
+	if p.Function != "" {
+		optional = fmt.Sprintf("%s; Func=[%s]", optional, p.Function)
+	}
+	for _, k := range extraParamKeys(data) {
+		optional = fmt.Sprintf("%s; %s=[%s]", optional, k, data[k])
+	}
+	if p.Stack != "" {
+		optional = fmt.Sprintf("%s\n%s", optional, p.Stack)
+	}
 
 	return fmt.Sprintf("%s%-5s %s%s", formattedTime, p.Level, p.Message, optional)
 }
 
-func extractKnownParams(data map[Param]string) KnownParams {
-	p := KnownParams{}
+// Params with a place of their own in the text line, or already rendered by another one
+var textLineParams = map[Param]bool{
+	TimeParam:       true,
+	LevelParam:      true,
+	MessageParam:    true,
+	ComponentParam:  true,
+	TxIDParam:       true,
+	ErrorParam:      true,
+	ErrorChainParam: true,
+	FileParam:       true,
+	LineParam:       true,
+	FunctionParam:   true,
+	StackParam:      true,
+	TxStatusParam:   true,
+}
+
+// extraParamKeys returns the sorted keys of the params appended to the text line, e.g. the
+// enrichment params
+func extraParamKeys(data map[Param]string) []Param {
+	var keys []Param
+	for k := range data {
+		if !textLineParams[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// formatRecord renders data in the configured format; text is the default
+func formatRecord(data map[Param]string, format string, userFriendly bool) string {
+	if format == JSONFormat {
+		return formatJSON(data)
+	}
+	return formatLine(data, userFriendly)
+}
+
+// formatJSON renders data as a single line JSON object; numeric params are emitted as numbers
+// and the error chain keeps its nested structure
+func formatJSON(data map[Param]string) string {
+	obj := make(map[Param]any, len(data))
+	for k, v := range data {
+		obj[k] = v
+	}
+
+	for _, numeric := range []Param{TimeParam, LineParam} {
+		if val, ok := data[numeric]; ok {
+			if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+				obj[numeric] = n
+			}
+		}
+	}
+	if val, ok := data[ErrorChainParam]; ok && json.Valid([]byte(val)) {
+		obj[ErrorChainParam] = json.RawMessage(val)
+	}
+
+	line, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Sprintf(`{"message":%q}`, fmt.Sprintf("failed to format record: %v", err))
+	}
+	return string(line)
+}
+
+// recordTime returns the TimeParam of data, or the current time if missing or invalid
+func recordTime(data map[Param]string) time.Time {
 	if val, ok := data[TimeParam]; ok {
-		parsedTime, err := strconv.ParseInt(val, 10, 64)
-		if err != nil {
-			p.Timestamp = parsedTime
+		if seconds, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return time.Unix(seconds, 0)
 		}
 	}
+	return time.Now()
+}
 
-	if p.Timestamp == 0 {
-		p.Timestamp = time.Now().Unix()
+func extractKnownParams(data map[Param]string) KnownParams {
+	p := KnownParams{
+		Timestamp: recordTime(data).Unix(),
 	}
 
 	if val, ok := data[LevelParam]; ok {
@@ -68,5 +160,25 @@ func extractKnownParams(data map[Param]string) KnownParams {
 		p.TxID = val
 	}
 
+	if val, ok := data[ErrorParam]; ok {
+		p.Error = val
+	}
+
+	if val, ok := data[FileParam]; ok {
+		p.File = val
+	}
+
+	if val, ok := data[LineParam]; ok {
+		p.Line, _ = strconv.Atoi(val)
+	}
+
+	if val, ok := data[FunctionParam]; ok {
+		p.Function = val
+	}
+
+	if val, ok := data[StackParam]; ok {
+		p.Stack = val
+	}
+
 	return p
 }
@@ -0,0 +1,21 @@
+package logsystem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatRecord_KeepsRecordTime(t *testing.T) {
+	data := map[Param]string{TimeParam: "1000", LevelParam: string(Info), MessageParam: "started"}
+
+	require.Equal(t, "[1000      ] INFO  started", formatRecord(data, TextFormat, false))
+	require.Equal(t, time.Unix(1000, 0).Format("[2006-01-02 15:04:05] ")+"INFO  started", formatRecord(data, TextFormat, true))
+	require.Equal(t, `{"level":"info","message":"started","time":1000}`, formatRecord(data, JSONFormat, false))
+	require.Equal(t, int64(1000), extractKnownParams(data).Timestamp)
+
+	// The current time when missing or invalid
+	before := time.Now().Unix()
+	require.GreaterOrEqual(t, extractKnownParams(map[Param]string{TimeParam: "soon"}).Timestamp, before)
+}
@@ -0,0 +1,98 @@
+package logsystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultHTTPTimeout = 10 * time.Second
+
+// httpConfig is embedded in the config of the drivers posting to an HTTP endpoint
+type httpConfig struct {
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	Gzip      bool              `json:"gzip"`
+	TimeoutMs int               `json:"timeoutMs"` // default 10000
+	Username  string            `json:"username"`  // basic auth
+	Password  string            `json:"password"`
+}
+
+// httpSender posts payloads and classifies the failures for the batcher retry logic
+type httpSender struct {
+	config httpConfig
+	client *http.Client
+}
+
+func newHTTPSender(config httpConfig) (*httpSender, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	timeout := defaultHTTPTimeout
+	if config.TimeoutMs > 0 {
+		timeout = time.Duration(config.TimeoutMs) * time.Millisecond
+	}
+	return &httpSender{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// post sends body to url, or to the configured URL if empty, and returns the response body.
+// Client errors other than 408 and 429 are permanent
+func (s *httpSender) post(url string, body []byte, contentType string, headers map[string]string) ([]byte, error) {
+	if url == "" {
+		url = s.config.URL
+	}
+
+	encoding := ""
+	if s.config.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+		encoding = "gzip"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, &permanentError{err: err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+	for k, v := range s.config.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return respBody, nil
+	}
+	err = fmt.Errorf("%s responded %s: %s", url, resp.Status, bytes.TrimSpace(respBody))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return respBody, &permanentError{err: err}
+	}
+	return respBody, err
+}
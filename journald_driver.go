@@ -0,0 +1,287 @@
+//go:build linux
+
+package logsystem
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const JournaldDriverID = "journald"
+
+const defaultJournaldSocket = "/run/systemd/journal/socket"
+
+// Maps the params with a well-known journal field; the other params are uppercased
+var journaldFieldNames = map[Param]string{
+	MessageParam:   "MESSAGE",
+	TxIDParam:      "TXID",
+	ComponentParam: "COMPONENT",
+	FileParam:      "CODE_FILE",
+	LineParam:      "CODE_LINE",
+	FunctionParam:  "CODE_FUNC",
+}
+
+type journaldConfig struct {
+	SocketPath string `json:"socketPath"` // defaults to /run/systemd/journal/socket
+	Identifier string `json:"identifier"` // SYSLOG_IDENTIFIER; defaults to the executable name
+}
+
+// JournaldDriverFactory implements DriverFactoryInterface
+type JournaldDriverFactory struct {
+}
+
+func (f *JournaldDriverFactory) DriverID() DriverID {
+	return DriverID(JournaldDriverID)
+}
+
+func (f *JournaldDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var journaldConfig journaldConfig
+	err := json.Unmarshal(config, &journaldConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal journald driver config: %w", err)
+	}
+	if journaldConfig.SocketPath == "" {
+		journaldConfig.SocketPath = defaultJournaldSocket
+	}
+	if journaldConfig.Identifier == "" {
+		journaldConfig.Identifier = filepath.Base(os.Args[0])
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldConfig.SocketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald socket: %s; error: %w", journaldConfig.SocketPath, err)
+	}
+
+	return NewSerialDriver(&JournaldDriver{
+		config: journaldConfig,
+		conn:   conn,
+	}), nil
+}
+
+// JournaldDriver implements DriverInterface
+// It sends every param as a journal field using the native journal protocol. Entries too large
+// for a datagram are passed as a sealed memfd. It isn't safe for concurrent use; the factory wraps
+// it by SerialDriver
+type JournaldDriver struct {
+	errorReporter
+
+	config journaldConfig
+	conn   *net.UnixConn
+}
+
+func (d *JournaldDriver) Log(data map[Param]string) {
+	d.send(data)
+}
+
+func (d *JournaldDriver) BeginTx(id TxID, attr map[Param]string) {
+	txData := make(map[Param]string)
+	for k, v := range attr {
+		txData[k] = v
+	}
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX Begin"
+	txData[LevelParam] = string(Info)
+	d.send(txData)
+}
+
+func (d *JournaldDriver) EndTx(id TxID) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.send(txData)
+}
+
+func (d *JournaldDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.send(txData)
+}
+
+func (d *JournaldDriver) Stop() {
+	d.conn.Close()
+}
+
+func (d *JournaldDriver) send(data map[Param]string) {
+	entry := d.encodeEntry(data)
+
+	_, err := d.conn.Write(entry)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		err = d.sendLarge(entry)
+	}
+	if err != nil {
+		d.reportError(fmt.Errorf("failed to send journald entry: %w", err))
+	}
+}
+
+// encodeEntry serializes the fields in the native protocol: "KEY=value\n" or, for values
+// containing a newline, "KEY\n" followed by the little endian 64 bit length, the value and "\n"
+func (d *JournaldDriver) encodeEntry(data map[Param]string) []byte {
+	fields := map[string]string{
+		"SYSLOG_IDENTIFIER": d.config.Identifier,
+	}
+	severity, ok := syslogSeverities[LogLevel(strings.ToLower(data[LevelParam]))]
+	if !ok {
+		severity = syslogSeverities[Info]
+	}
+	fields["PRIORITY"] = fmt.Sprint(severity)
+
+	for k, v := range data {
+		// The journal keeps its own timestamps; the level is carried as PRIORITY
+		if k == TimeParam || k == LevelParam {
+			continue
+		}
+		name, ok := journaldFieldNames[k]
+		if !ok {
+			name = journaldFieldName(string(k))
+		}
+		if name != "" {
+			fields[name] = v
+		}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		value := fields[name]
+		if strings.Contains(value, "\n") {
+			buf.WriteString(name)
+			buf.WriteByte('\n')
+			binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+			buf.WriteString(value)
+			buf.WriteByte('\n')
+			continue
+		}
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// journaldFieldName converts a param into a valid field name: uppercase letters, digits and
+// underscores, not starting with an underscore or digit, at most 64 characters
+func journaldFieldName(param string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		default:
+			return '_'
+		}
+	}, param)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// sendLarge writes the entry into a sealed memfd and passes its descriptor to journald
+func (d *JournaldDriver) sendLarge(entry []byte) error {
+	file, err := memfdCreate("logsystem-journald")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(entry)
+	if err != nil {
+		return err
+	}
+	_, err = fcntl(file.Fd(), fcntlAddSeals, sealSeal|sealShrink|sealGrow|sealWrite)
+	if err != nil {
+		return err
+	}
+
+	// WriteMsgUnix refuses connected datagram sockets, so send on the raw descriptor
+	rawConn, err := d.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sendErr error
+	err = rawConn.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendmsg(int(fd), nil, syscall.UnixRights(int(file.Fd())), nil, 0)
+		return sendErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fcntlAddSeals   = 0x409
+	sealSeal        = 0x1
+	sealShrink      = 0x2
+	sealGrow        = 0x4
+	sealWrite       = 0x8
+)
+
+// The syscall package doesn't export memfd_create for every architecture
+var memfdCreateSyscall = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"riscv64":  279,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"s390x":    350,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+}
+
+func memfdCreate(name string) (*os.File, error) {
+	trap, ok := memfdCreateSyscall[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("memfd_create is not supported on %s", runtime.GOARCH)
+	}
+	namePtr, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(namePtr)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, name), nil
+}
+
+func fcntl(fd uintptr, cmd int, arg int) (int, error) {
+	r, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, uintptr(cmd), uintptr(arg))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
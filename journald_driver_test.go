@@ -0,0 +1,115 @@
+//go:build linux
+
+package logsystem
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// parseJournalEntry decodes the native journal protocol
+func parseJournalEntry(t *testing.T, entry []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(entry) > 0 {
+		nl := bytes.IndexByte(entry, '\n')
+		require.GreaterOrEqual(t, nl, 0)
+		line := string(entry[:nl])
+		entry = entry[nl+1:]
+		if name, value, ok := strings.Cut(line, "="); ok {
+			fields[name] = value
+			continue
+		}
+		size := binary.LittleEndian.Uint64(entry[:8])
+		fields[line] = string(entry[8 : 8+size])
+		require.Equal(t, byte('\n'), entry[8+size])
+		entry = entry[8+size+1:]
+	}
+	return fields
+}
+
+func listenJournal(t *testing.T) (*net.UnixConn, DriverInterface) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	drv, err := (&JournaldDriverFactory{}).CreateDriver(json.RawMessage(`{"socketPath":"` + socket + `","identifier":"test"}`))
+	require.NoError(t, err)
+	_, ok := drv.(*SerialDriver)
+	require.True(t, ok)
+	t.Cleanup(drv.Stop)
+	return listener, drv
+}
+
+func TestJournaldDriver_Fields(t *testing.T) {
+	listener, drv := listenJournal(t)
+
+	drv.Log(map[Param]string{
+		MessageParam:   "failed",
+		LevelParam:     string(Error),
+		TimeParam:      "1700000000",
+		TxIDParam:      "4",
+		ComponentParam: "db",
+		StackParam:     "main.main\n\tmain.go:10",
+		"user-id":      "123",
+	})
+
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 64*1024)
+	n, err := listener.Read(buf)
+	require.NoError(t, err)
+
+	fields := parseJournalEntry(t, buf[:n])
+	require.Equal(t, map[string]string{
+		"MESSAGE":           "failed",
+		"PRIORITY":          "3",
+		"TXID":              "4",
+		"COMPONENT":         "db",
+		"STACK":             "main.main\n\tmain.go:10",
+		"USER_ID":           "123",
+		"SYSLOG_IDENTIFIER": "test",
+	}, fields)
+}
+
+func TestJournaldDriver_LargeEntryUsesMemfd(t *testing.T) {
+	listener, drv := listenJournal(t)
+
+	message := strings.Repeat("x", 4*1024*1024)
+	drv.Log(map[Param]string{MessageParam: message, LevelParam: string(Info)})
+
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := listener.ReadMsgUnix(make([]byte, 16), oob)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	require.NoError(t, err)
+	require.Len(t, fds, 1)
+
+	file := os.NewFile(uintptr(fds[0]), "memfd")
+	defer file.Close()
+	// The descriptor shares the write offset of the sender
+	_, err = file.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	entry, err := io.ReadAll(file)
+	require.NoError(t, err)
+
+	fields := parseJournalEntry(t, entry)
+	require.Equal(t, message, fields["MESSAGE"])
+	require.Equal(t, "6", fields["PRIORITY"])
+}
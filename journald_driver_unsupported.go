@@ -0,0 +1,22 @@
+//go:build !linux
+
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const JournaldDriverID = "journald"
+
+// JournaldDriverFactory implements DriverFactoryInterface; journald is only available on Linux
+type JournaldDriverFactory struct {
+}
+
+func (f *JournaldDriverFactory) DriverID() DriverID {
+	return DriverID(JournaldDriverID)
+}
+
+func (f *JournaldDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	return nil, errors.New("journald driver is only supported on linux")
+}
@@ -6,7 +6,8 @@ import (
 )
 
 type Logger struct {
-	mgr *DriverManager
+	mgr    *DriverManager
+	config LoggerConfig
 }
 
 type TxLogger struct {
@@ -21,10 +22,37 @@ func NewLogger(m *DriverManager) *Logger {
 	}
 }
 
+func NewLoggerWithConfig(m *DriverManager, config LoggerConfig) *Logger {
+	return &Logger{
+		mgr:    m,
+		config: config,
+	}
+}
+
+// SetCaptureCaller enables adding file, line and function of the log call to each record
+func (l *Logger) SetCaptureCaller(enabled bool) {
+	l.config.CaptureCaller = enabled
+}
+
+// SetStackTraceOnError enables adding the stack trace of the log call to Error records
+func (l *Logger) SetStackTraceOnError(enabled bool) {
+	l.config.StackTraceOnError = enabled
+}
+
 func (l *Logger) Stop() {
 	l.mgr.stop()
 }
 
+// Flush asks buffering drivers to persist their pending data
+func (l *Logger) Flush() {
+	l.mgr.flush()
+}
+
+// Dump asks the drivers keeping a history of the records, e.g. the ring buffer, to write it out
+func (l *Logger) Dump() {
+	l.mgr.dump()
+}
+
 func (l *Logger) Info(message string) {
 	l.logBasic(message, Info)
 }
@@ -41,6 +69,11 @@ func (l *Logger) Error(message string) {
 	l.logBasic(message, Error)
 }
 
+// ErrorErr logs err and its wrapped-error chain at Error level; message defaults to the error text
+func (l *Logger) ErrorErr(err error, message string) {
+	l.logError(err, message)
+}
+
 func (l *Logger) BeginTx(attr map[Param]string) TxLogger {
 	return l.BeginTxWithComponent("", attr)
 }
@@ -56,25 +89,33 @@ func (l *Logger) BeginTxWithComponent(component string, attr map[Param]string) T
 }
 
 func (tl TxLogger) Info(message string) {
-	tl.logAttrib(message, Info)
+	tl.logAttrib(message, Info, nil)
 }
 
 func (tl TxLogger) Debug(message string) {
-	tl.logAttrib(message, Debug)
+	tl.logAttrib(message, Debug, nil)
 }
 
 func (tl TxLogger) Warn(message string) {
-	tl.logAttrib(message, Warn)
+	tl.logAttrib(message, Warn, nil)
 }
 
 func (tl TxLogger) Error(message string) {
-	tl.logAttrib(message, Error)
+	tl.logAttrib(message, Error, nil)
+}
+
+// ErrorErr logs err and its wrapped-error chain at Error level; message defaults to the error text
+func (tl TxLogger) ErrorErr(err error, message string) {
+	tl.logAttrib(errorMessage(err, message), Error, errorParams(err))
 }
 
-func (tl TxLogger) logAttrib(message string, level LogLevel) {
+func (tl TxLogger) logAttrib(message string, level LogLevel, attributes map[Param]string) {
 	extra := map[Param]string{
 		TxIDParam: tl.txID.String(),
 	}
+	for k, v := range attributes {
+		extra[k] = v
+	}
 	if tl.component != "" {
 		extra[ComponentParam] = tl.component
 	}
@@ -85,16 +126,33 @@ func (tl TxLogger) EndTx() {
 	tl.logger.mgr.endTx(tl.txID)
 }
 
+// EndTxWithStatus ends the transaction recording whether it succeeded
+func (tl TxLogger) EndTxWithStatus(status TxStatus) {
+	tl.logger.mgr.endTxWithStatus(tl.txID, status)
+}
+
 func (l *Logger) logBasic(message string, level LogLevel) {
 	l.logAttrib(message, level, nil)
 }
 
+func (l *Logger) logError(err error, message string) {
+	l.logAttrib(errorMessage(err, message), Error, errorParams(err))
+}
+
 func (l *Logger) logAttrib(message string, level LogLevel, attributes map[Param]string) {
 	data := map[Param]string{
 		MessageParam: message,
 		TimeParam:    strconv.FormatInt(time.Now().Unix(), 10),
 		LevelParam:   string(level),
 	}
+	if l.config.CaptureCaller {
+		for k, v := range callerParams(callerSkip) {
+			data[k] = v
+		}
+	}
+	if l.config.StackTraceOnError && level == Error {
+		data[StackParam] = stackTrace(callerSkip)
+	}
 	for k, v := range attributes {
 		data[k] = v
 	}
@@ -0,0 +1,134 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RecordingDriver keeps everything it receives; implements DriverInterface
+type RecordingDriver struct {
+	mutex    sync.Mutex
+	records  []map[Param]string
+	begins   []TxID
+	attrs    map[TxID]map[Param]string
+	ends     []TxID
+	statuses map[TxID]TxStatus
+	flushes  int
+	stopped  bool
+}
+
+func (d *RecordingDriver) Log(data map[Param]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.records = append(d.records, data)
+}
+
+func (d *RecordingDriver) BeginTx(id TxID, attr map[Param]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.begins = append(d.begins, id)
+	if d.attrs == nil {
+		d.attrs = make(map[TxID]map[Param]string)
+	}
+	d.attrs[id] = attr
+}
+
+func (d *RecordingDriver) EndTx(id TxID) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.ends = append(d.ends, id)
+}
+
+func (d *RecordingDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.ends = append(d.ends, id)
+	if d.statuses == nil {
+		d.statuses = make(map[TxID]TxStatus)
+	}
+	d.statuses[id] = status
+}
+
+func (d *RecordingDriver) Flush() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.flushes++
+}
+
+func (d *RecordingDriver) Status(id TxID) TxStatus {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.statuses[id]
+}
+
+func (d *RecordingDriver) Stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stopped = true
+}
+
+func (d *RecordingDriver) Records() []map[Param]string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]map[Param]string{}, d.records...)
+}
+
+// RecordingDriverFactory hands out its RecordingDriver; implements DriverFactoryInterface
+type RecordingDriverFactory struct {
+	id     DriverID
+	driver *RecordingDriver
+}
+
+func (f *RecordingDriverFactory) DriverID() DriverID {
+	return f.id
+}
+
+func (f *RecordingDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	return f.driver, nil
+}
+
+func newRecordingLogger(config LoggerConfig) (*Logger, *RecordingDriver) {
+	drv := &RecordingDriver{}
+	m := NewManager()
+	m.AddDriver(drv)
+	return NewLoggerWithConfig(m, config), drv
+}
+
+func TestLogger_CaptureCaller(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{CaptureCaller: true})
+
+	_, _, line, _ := runtime.Caller(0)
+	l.Info("plain")
+	tl := l.BeginTxWithComponent("comp", nil)
+	tl.Warn("in tx")
+
+	records := drv.Records()
+	require.Len(t, records, 2)
+	for i, record := range records {
+		require.Equal(t, "logger_test.go", filepath.Base(record[FileParam]))
+		require.Equal(t, strconv.Itoa(line+1+i*2), record[LineParam])
+		require.Equal(t, "logsystem.TestLogger_CaptureCaller", record[FunctionParam])
+		require.NotContains(t, record, StackParam)
+	}
+}
+
+func TestLogger_StackTraceOnError(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{})
+	l.Error("no stack yet")
+	l.SetStackTraceOnError(true)
+	l.Warn("no stack for warnings")
+	l.Error("with stack")
+
+	records := drv.Records()
+	require.Len(t, records, 3)
+	require.NotContains(t, records[0], StackParam)
+	require.NotContains(t, records[1], StackParam)
+	require.Contains(t, records[2][StackParam], "logsystem.TestLogger_StackTraceOnError\n\t")
+	require.NotContains(t, records[2][StackParam], "logsystem.(*Logger)")
+}
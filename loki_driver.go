@@ -0,0 +1,269 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const LokiDriverID = "loki"
+
+const (
+	LokiJSONEncoding     = "json"
+	LokiProtobufEncoding = "protobuf"
+)
+
+type lokiConfig struct {
+	httpConfig
+	batchConfig
+
+	TenantID    string            `json:"tenantID"`    // sent as X-Scope-OrgID
+	Labels      map[string]string `json:"labels"`      // static labels of every stream
+	LabelParams []Param           `json:"labelParams"` // params promoted to labels; default component and level
+	Encoding    string            `json:"encoding"`    // json (default) or protobuf
+}
+
+// LokiDriverFactory implements DriverFactoryInterface
+type LokiDriverFactory struct {
+}
+
+func (f *LokiDriverFactory) DriverID() DriverID {
+	return DriverID(LokiDriverID)
+}
+
+func (f *LokiDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var lokiConfig lokiConfig
+	err := json.Unmarshal(config, &lokiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal loki driver config: %w", err)
+	}
+
+	if lokiConfig.LabelParams == nil {
+		lokiConfig.LabelParams = []Param{ComponentParam, LevelParam}
+	}
+	switch lokiConfig.Encoding {
+	case "":
+		lokiConfig.Encoding = LokiJSONEncoding
+	case LokiJSONEncoding:
+	case LokiProtobufEncoding:
+		// The protobuf payload is snappy compressed instead
+		lokiConfig.Gzip = false
+	default:
+		return nil, fmt.Errorf("unknown loki encoding: %s", lokiConfig.Encoding)
+	}
+
+	sender, err := newHTTPSender(lokiConfig.httpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid loki driver config: %w", err)
+	}
+
+	d := &LokiDriver{
+		config: lokiConfig,
+		sender: sender,
+	}
+	d.batcher = newBatcher("loki", lokiConfig.batchConfig, d.push, &d.errorReporter)
+	return d, nil
+}
+
+type lokiEntry struct {
+	labels    map[string]string
+	timestamp time.Time
+	line      string
+}
+
+// LokiDriver implements DriverInterface
+// It batches records into Loki push requests. The configured params become stream labels,
+// the remaining params are kept in the JSON log line
+type LokiDriver struct {
+	errorReporter
+
+	config  lokiConfig
+	sender  *httpSender
+	batcher *batcher[lokiEntry]
+}
+
+func (d *LokiDriver) Log(data map[Param]string) {
+	d.batcher.add(d.newEntry(data))
+}
+
+func (d *LokiDriver) BeginTx(id TxID, attr map[Param]string) {
+	txData := make(map[Param]string)
+	for k, v := range attr {
+		txData[k] = v
+	}
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX Begin"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *LokiDriver) EndTx(id TxID) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *LokiDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+}
+
+func (d *LokiDriver) Flush() {
+	d.batcher.flush()
+}
+
+// ReportsErrorsAsync is true: the records are sent in batches
+func (d *LokiDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+func (d *LokiDriver) Stop() {
+	d.batcher.stop()
+}
+
+func (d *LokiDriver) newEntry(data map[Param]string) lokiEntry {
+	labels := make(map[string]string, len(d.config.Labels)+len(d.config.LabelParams))
+	for k, v := range d.config.Labels {
+		labels[lokiLabelName(k)] = v
+	}
+
+	rest := make(map[Param]string, len(data))
+	for k, v := range data {
+		if k != TimeParam {
+			rest[k] = v
+		}
+	}
+	for _, param := range d.config.LabelParams {
+		if val, ok := rest[param]; ok {
+			labels[lokiLabelName(string(param))] = val
+			delete(rest, param)
+		}
+	}
+
+	return lokiEntry{
+		labels:    labels,
+		timestamp: recordTime(data),
+		line:      formatJSON(rest),
+	}
+}
+
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+// push groups the entries by label set and sends them in one request
+func (d *LokiDriver) push(entries []lokiEntry) ([]lokiEntry, error) {
+	streams := make(map[string]*lokiStream)
+	keys := make([]string, 0)
+	for _, entry := range entries {
+		key := lokiLabelString(entry.labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{labels: entry.labels}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+		stream.entries = append(stream.entries, entry)
+	}
+
+	var body []byte
+	var contentType string
+	if d.config.Encoding == LokiProtobufEncoding {
+		body = lokiProtobufPayload(keys, streams)
+		contentType = "application/x-protobuf"
+	} else {
+		var err error
+		body, err = lokiJSONPayload(keys, streams)
+		if err != nil {
+			return nil, &permanentError{err: err}
+		}
+		contentType = "application/json"
+	}
+
+	headers := map[string]string{}
+	if d.config.TenantID != "" {
+		headers["X-Scope-OrgID"] = d.config.TenantID
+	}
+	_, err := d.sender.post("", body, contentType, headers)
+	return nil, err
+}
+
+func lokiJSONPayload(keys []string, streams map[string]*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	payload := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+	for _, key := range keys {
+		stream := streams[key]
+		js := jsonStream{Stream: stream.labels}
+		for _, entry := range stream.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(entry.timestamp.UnixNano(), 10), entry.line})
+		}
+		payload.Streams = append(payload.Streams, js)
+	}
+	return json.Marshal(payload)
+}
+
+// lokiProtobufPayload encodes a snappy compressed logproto.PushRequest
+func lokiProtobufPayload(keys []string, streams map[string]*lokiStream) []byte {
+	var req []byte
+	for _, key := range keys {
+		var stream []byte
+		stream = protoAppendString(stream, 1, key)
+		for _, entry := range streams[key].entries {
+			var ts []byte
+			ts = protoAppendUint(ts, 1, uint64(entry.timestamp.Unix()))
+			ts = protoAppendUint(ts, 2, uint64(entry.timestamp.Nanosecond()))
+
+			var e []byte
+			e = protoAppendMessage(e, 1, ts)
+			e = protoAppendString(e, 2, entry.line)
+			stream = protoAppendMessage(stream, 2, e)
+		}
+		req = protoAppendMessage(req, 1, stream)
+	}
+	return snappyEncode(req)
+}
+
+// lokiLabelString renders the labels in the Prometheus selector format, e.g. {app="x", level="info"}
+func lokiLabelString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, strconv.Quote(labels[name])))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// lokiLabelName keeps the characters allowed in label names: [a-zA-Z_][a-zA-Z0-9_]*
+func lokiLabelName(name string) string {
+	sanitized := []rune(name)
+	for i, r := range sanitized {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')
+		if !valid {
+			sanitized[i] = '_'
+		}
+	}
+	return string(sanitized)
+}
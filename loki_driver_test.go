@@ -0,0 +1,149 @@
+package logsystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type lokiPushRequest struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+// recordedRequest is what a test server received; the handlers only record the requests, the
+// assertions run on the test goroutine
+type recordedRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+	err    error
+}
+
+func recordRequest(r *http.Request) recordedRequest {
+	body, err := io.ReadAll(r.Body)
+	return recordedRequest{path: r.URL.Path, header: r.Header.Clone(), body: body, err: err}
+}
+
+func TestLokiDriver_JSONPush(t *testing.T) {
+	var mutex sync.Mutex
+	var received []recordedRequest
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, recordRequest(r))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	drv, err := (&LokiDriverFactory{}).CreateDriver(json.RawMessage(`{
+		"url": "` + server.URL + `/loki/api/v1/push",
+		"tenantID": "tenant-1",
+		"gzip": true,
+		"labels": {"app": "test", "env-name": "dev"},
+		"retryBackoffMs": 1
+	}`))
+	require.NoError(t, err)
+
+	drv.Log(map[Param]string{MessageParam: "one", LevelParam: "info", TimeParam: "1700000000", ComponentParam: "db"})
+	drv.Log(map[Param]string{MessageParam: "two", LevelParam: "info", TimeParam: "1700000001", ComponentParam: "db", TxIDParam: "3"})
+	drv.Log(map[Param]string{MessageParam: "three", LevelParam: "error", TimeParam: "1700000002"})
+	drv.Stop()
+
+	require.Equal(t, 2, attempts)
+	require.Len(t, received, 1)
+	require.NoError(t, received[0].err)
+	require.Equal(t, "/loki/api/v1/push", received[0].path)
+	require.Equal(t, "tenant-1", received[0].header.Get("X-Scope-OrgID"))
+	require.Equal(t, "gzip", received[0].header.Get("Content-Encoding"))
+	zr, err := gzip.NewReader(bytes.NewReader(received[0].body))
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	var req lokiPushRequest
+	require.NoError(t, json.Unmarshal(body, &req))
+	streams := req.Streams
+	require.Len(t, streams, 2)
+
+	require.Equal(t, map[string]string{"app": "test", "env_name": "dev", "component": "db", "level": "info"}, streams[0].Stream)
+	require.Equal(t, [][2]string{
+		{"1700000000000000000", `{"message":"one"}`},
+		{"1700000001000000000", `{"message":"two","txID":"3"}`},
+	}, streams[0].Values)
+
+	require.Equal(t, map[string]string{"app": "test", "env_name": "dev", "level": "error"}, streams[1].Stream)
+	require.Equal(t, [][2]string{{"1700000002000000000", `{"message":"three"}`}}, streams[1].Values)
+}
+
+func TestLokiDriver_ProtobufPush(t *testing.T) {
+	requests := make(chan recordedRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- recordRequest(r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	drv, err := (&LokiDriverFactory{}).CreateDriver(json.RawMessage(`{"url":"` + server.URL + `","encoding":"protobuf","labelParams":["level"]}`))
+	require.NoError(t, err)
+	drv.Log(map[Param]string{MessageParam: "hello", LevelParam: "warn", TimeParam: "1700000000"})
+	drv.Stop()
+
+	received := <-requests
+	require.NoError(t, received.err)
+	require.Equal(t, "application/x-protobuf", received.header.Get("Content-Type"))
+	req := parseProto(t, snappyDecodeLiterals(t, received.body))
+	require.Len(t, req[1], 1)
+	stream := parseProto(t, req[1][0].bytes)
+	require.Equal(t, `{level="warn"}`, string(stream[1][0].bytes))
+	require.Len(t, stream[2], 1)
+	entry := parseProto(t, stream[2][0].bytes)
+	ts := parseProto(t, entry[1][0].bytes)
+	require.Equal(t, uint64(1700000000), ts[1][0].varint)
+	require.Equal(t, `{"message":"hello"}`, string(entry[2][0].bytes))
+}
+
+func TestLokiDriver_PermanentErrorIsNotRetried(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		http.Error(w, "bad labels", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	drv, err := (&LokiDriverFactory{}).CreateDriver(json.RawMessage(`{"url":"` + server.URL + `","retryBackoffMs":1}`))
+	require.NoError(t, err)
+	var reported []error
+	drv.(*LokiDriver).SetErrorHandler(func(err error) {
+		reported = append(reported, err)
+	})
+	drv.Log(map[Param]string{MessageParam: "hello"})
+	drv.Stop()
+	// Stopping twice is harmless
+	drv.Stop()
+
+	require.Equal(t, 1, attempts)
+	require.Len(t, reported, 1)
+
+	// The records logged after stop are reported, not queued silently
+	drv.Log(map[Param]string{MessageParam: "late"})
+	require.Len(t, reported, 2)
+	require.EqualError(t, reported[1], "loki: record dropped, the driver is stopped")
+}
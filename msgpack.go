@@ -0,0 +1,269 @@
+package logsystem
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Minimal MessagePack encoding, enough for the Fluent Forward protocol
+
+func msgpackAppendUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<7:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+	}
+}
+
+func msgpackAppendString(b []byte, v string) []byte {
+	n := len(v)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, v...)
+}
+
+func msgpackAppendBinary(b []byte, v []byte) []byte {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, v...)
+}
+
+func msgpackAppendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func msgpackAppendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// msgpackAppendEventTime appends the Fluent EventTime extension (type 0): seconds and nanoseconds
+func msgpackAppendEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+// msgpackExt is a decoded extension value
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+// msgpackDecode decodes one value into nil, bool, int64, uint64, float64, string, []byte,
+// []any, map[string]any or msgpackExt and returns the remaining data
+func msgpackDecode(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, b, errMsgpackShort
+	}
+	c := b[0]
+	b = b[1:]
+
+	switch {
+	case c <= 0x7f:
+		return uint64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xf0 == 0x80:
+		return msgpackDecodeMap(b, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return msgpackDecodeArray(b, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		return msgpackDecodeBytes(b, int(c&0x1f), true)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+	case 0xc4, 0xd9:
+		n, rest, err := msgpackReadLength(b, 1)
+		if err != nil {
+			return nil, b, err
+		}
+		return msgpackDecodeBytes(rest, n, c == 0xd9)
+	case 0xc5, 0xda:
+		n, rest, err := msgpackReadLength(b, 2)
+		if err != nil {
+			return nil, b, err
+		}
+		return msgpackDecodeBytes(rest, n, c == 0xda)
+	case 0xc6, 0xdb:
+		n, rest, err := msgpackReadLength(b, 4)
+		if err != nil {
+			return nil, b, err
+		}
+		return msgpackDecodeBytes(rest, n, c == 0xdb)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		size := 1 << (c - 0xcc)
+		if len(b) < size {
+			return nil, b, errMsgpackShort
+		}
+		return msgpackReadUint(b[:size]), b[size:], nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		if len(b) < size {
+			return nil, b, errMsgpackShort
+		}
+		v := msgpackReadUint(b[:size])
+		shift := 64 - 8*size
+		return int64(v<<shift) >> shift, b[size:], nil
+	case 0xca:
+		if len(b) < 4 {
+			return nil, b, errMsgpackShort
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), b[4:], nil
+	case 0xcb:
+		if len(b) < 8 {
+			return nil, b, errMsgpackShort
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+	case 0xdc:
+		n, rest, err := msgpackReadLength(b, 2)
+		if err != nil {
+			return nil, b, err
+		}
+		return msgpackDecodeArray(rest, n)
+	case 0xdd:
+		n, rest, err := msgpackReadLength(b, 4)
+		if err != nil {
+			return nil, b, err
+		}
+		return msgpackDecodeArray(rest, n)
+	case 0xde:
+		n, rest, err := msgpackReadLength(b, 2)
+		if err != nil {
+			return nil, b, err
+		}
+		return msgpackDecodeMap(rest, n)
+	case 0xdf:
+		n, rest, err := msgpackReadLength(b, 4)
+		if err != nil {
+			return nil, b, err
+		}
+		return msgpackDecodeMap(rest, n)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return msgpackDecodeExt(b, 1<<(c-0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, rest, err := msgpackReadLength(b, 1<<(c-0xc7))
+		if err != nil {
+			return nil, b, err
+		}
+		return msgpackDecodeExt(rest, n)
+	}
+	return nil, b, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+}
+
+func msgpackReadUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func msgpackReadLength(b []byte, size int) (int, []byte, error) {
+	if len(b) < size {
+		return 0, b, errMsgpackShort
+	}
+	return int(msgpackReadUint(b[:size])), b[size:], nil
+}
+
+func msgpackDecodeBytes(b []byte, n int, asString bool) (any, []byte, error) {
+	if len(b) < n {
+		return nil, b, errMsgpackShort
+	}
+	if asString {
+		return string(b[:n]), b[n:], nil
+	}
+	return append([]byte{}, b[:n]...), b[n:], nil
+}
+
+func msgpackDecodeExt(b []byte, n int) (any, []byte, error) {
+	if len(b) < n+1 {
+		return nil, b, errMsgpackShort
+	}
+	return msgpackExt{Type: int8(b[0]), Data: append([]byte{}, b[1:n+1]...)}, b[n+1:], nil
+}
+
+func msgpackDecodeArray(b []byte, n int) (any, []byte, error) {
+	// Each element takes at least one byte
+	if n > len(b) {
+		return nil, b, errMsgpackShort
+	}
+	arr := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		var v any
+		var err error
+		v, b, err = msgpackDecode(b)
+		if err != nil {
+			return nil, b, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, b, nil
+}
+
+func msgpackDecodeMap(b []byte, n int) (any, []byte, error) {
+	if 2*n > len(b) {
+		return nil, b, errMsgpackShort
+	}
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		var k, v any
+		var err error
+		k, b, err = msgpackDecode(b)
+		if err != nil {
+			return nil, b, err
+		}
+		v, b, err = msgpackDecode(b)
+		if err != nil {
+			return nil, b, err
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, b, nil
+}
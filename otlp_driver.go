@@ -0,0 +1,445 @@
+package logsystem
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const OTLPDriverID = "otlp"
+
+const (
+	OTLPProtobufEncoding = "protobuf"
+	OTLPJSONEncoding     = "json"
+)
+
+const (
+	otlpLogsPath   = "/v1/logs"
+	otlpTracesPath = "/v1/traces"
+	otlpScopeName  = "logsystem"
+)
+
+// OTLP SeverityNumber of the log levels
+var otlpSeverities = map[LogLevel]int{
+	Debug: 5,
+	Info:  9,
+	Warn:  13,
+	Error: 17,
+}
+
+// OTLP Status.code and Span.kind values
+const (
+	otlpStatusUnset = 0
+	otlpStatusOk    = 1
+	otlpStatusError = 2
+
+	otlpSpanKindInternal = 1
+)
+
+type otlpConfig struct {
+	httpConfig // url is the collector base URL; records go to /v1/logs and spans to /v1/traces
+	batchConfig
+
+	Encoding           string            `json:"encoding"`    // protobuf (default) or json
+	ServiceName        string            `json:"serviceName"` // defaults to the executable name
+	ResourceAttributes map[string]string `json:"resourceAttributes"`
+	ExportSpans        bool              `json:"exportSpans"` // export transactions as spans
+}
+
+// OTLPDriverFactory implements DriverFactoryInterface
+type OTLPDriverFactory struct {
+}
+
+func (f *OTLPDriverFactory) DriverID() DriverID {
+	return DriverID(OTLPDriverID)
+}
+
+func (f *OTLPDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var otlpConfig otlpConfig
+	err := json.Unmarshal(config, &otlpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal otlp driver config: %w", err)
+	}
+
+	switch otlpConfig.Encoding {
+	case "":
+		otlpConfig.Encoding = OTLPProtobufEncoding
+	case OTLPProtobufEncoding, OTLPJSONEncoding:
+	default:
+		return nil, fmt.Errorf("unknown otlp encoding: %s", otlpConfig.Encoding)
+	}
+	if otlpConfig.ServiceName == "" {
+		otlpConfig.ServiceName = filepath.Base(os.Args[0])
+	}
+	otlpConfig.URL = strings.TrimSuffix(otlpConfig.URL, "/")
+
+	sender, err := newHTTPSender(otlpConfig.httpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otlp driver config: %w", err)
+	}
+
+	d := &OTLPDriver{
+		config:  otlpConfig,
+		sender:  sender,
+		openTxs: make(map[TxID]otlpOpenTx),
+	}
+	// Trace IDs are unique per driver instance, the transaction ID fills the lower half
+	_, err = rand.Read(d.tracePrefix[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate otlp trace id prefix: %w", err)
+	}
+
+	attributes := map[string]string{"service.name": otlpConfig.ServiceName}
+	for k, v := range otlpConfig.ResourceAttributes {
+		attributes[k] = v
+	}
+	d.resource = otlpAttributes(attributes)
+
+	d.logs = newBatcher("otlp logs", otlpConfig.batchConfig, d.exportLogs, &d.errorReporter)
+	if otlpConfig.ExportSpans {
+		d.spans = newBatcher("otlp spans", otlpConfig.batchConfig, d.exportSpans, &d.errorReporter)
+	}
+	return d, nil
+}
+
+type otlpOpenTx struct {
+	start time.Time
+	attr  map[Param]string
+}
+
+// OTLPDriver implements DriverInterface
+// It maps the records to the OTLP LogRecord data model; records of a transaction share the
+// trace and span IDs derived from the transaction ID, optionally exported as a span too
+type OTLPDriver struct {
+	errorReporter
+
+	config      otlpConfig
+	sender      *httpSender
+	resource    []otlpKeyValue
+	tracePrefix [8]byte
+
+	logs  *batcher[otlpLogRecord]
+	spans *batcher[otlpSpan]
+
+	txMutex sync.Mutex
+	openTxs map[TxID]otlpOpenTx
+}
+
+func (d *OTLPDriver) Log(data map[Param]string) {
+	d.logs.add(d.newLogRecord(data))
+}
+
+func (d *OTLPDriver) BeginTx(id TxID, attr map[Param]string) {
+	if d.spans == nil {
+		return
+	}
+	d.txMutex.Lock()
+	defer d.txMutex.Unlock()
+	d.openTxs[id] = otlpOpenTx{start: time.Now(), attr: attr}
+}
+
+func (d *OTLPDriver) EndTx(id TxID) {
+	d.endSpan(id, otlpStatusUnset)
+}
+
+func (d *OTLPDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	code := otlpStatusOk
+	if status == TxFailed {
+		code = otlpStatusError
+	}
+	d.endSpan(id, code)
+}
+
+func (d *OTLPDriver) Flush() {
+	d.logs.flush()
+	if d.spans != nil {
+		d.spans.flush()
+	}
+}
+
+// ReportsErrorsAsync is true: the records are sent in batches
+func (d *OTLPDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+func (d *OTLPDriver) Stop() {
+	d.logs.stop()
+	if d.spans != nil {
+		d.spans.stop()
+	}
+}
+
+func (d *OTLPDriver) endSpan(id TxID, statusCode int) {
+	if d.spans == nil {
+		return
+	}
+	d.txMutex.Lock()
+	tx, ok := d.openTxs[id]
+	delete(d.openTxs, id)
+	d.txMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	attributes := make(map[string]string, len(tx.attr))
+	for k, v := range tx.attr {
+		attributes[string(k)] = v
+	}
+	d.spans.add(otlpSpan{
+		TraceID:           d.traceID(id),
+		SpanID:            otlpSpanID(id),
+		Name:              "tx " + id.String(),
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: uint64(tx.start.UnixNano()),
+		EndTimeUnixNano:   uint64(time.Now().UnixNano()),
+		Attributes:        otlpAttributes(attributes),
+		Status:            otlpStatus{Code: statusCode},
+	})
+}
+
+func (d *OTLPDriver) newLogRecord(data map[Param]string) otlpLogRecord {
+	level := LogLevel(strings.ToLower(data[LevelParam]))
+	severity, ok := otlpSeverities[level]
+	if !ok {
+		severity = otlpSeverities[Info]
+	}
+
+	record := otlpLogRecord{
+		TimeUnixNano:         uint64(recordTime(data).UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severity,
+		SeverityText:         strings.ToUpper(string(level)),
+		Body:                 otlpAnyValue{StringValue: data[MessageParam]},
+	}
+
+	attributes := make(map[string]string, len(data))
+	for k, v := range data {
+		if k == MessageParam || k == TimeParam || k == LevelParam {
+			continue
+		}
+		attributes[otlpAttributeName(k)] = v
+	}
+	record.Attributes = otlpAttributes(attributes)
+
+	if txID, ok := data[TxIDParam]; ok {
+		var id TxID
+		if _, err := fmt.Sscan(txID, &id); err == nil {
+			record.TraceID = d.traceID(id)
+			record.SpanID = otlpSpanID(id)
+		}
+	}
+	return record
+}
+
+func (d *OTLPDriver) traceID(id TxID) otlpID {
+	traceID := make([]byte, 16)
+	copy(traceID, d.tracePrefix[:])
+	binary.BigEndian.PutUint64(traceID[8:], uint64(id))
+	return traceID
+}
+
+func otlpSpanID(id TxID) otlpID {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+// Standard params get the OpenTelemetry semantic convention names
+var otlpAttributeNames = map[Param]string{
+	FileParam:       "code.filepath",
+	LineParam:       "code.lineno",
+	FunctionParam:   "code.function",
+	StackParam:      "exception.stacktrace",
+	ErrorParam:      "exception.message",
+	ComponentParam:  "component",
+	TxIDParam:       "transaction.id",
+	TxStatusParam:   "transaction.status",
+	ErrorChainParam: "exception.chain",
+}
+
+func otlpAttributeName(param Param) string {
+	if name, ok := otlpAttributeNames[param]; ok {
+		return name
+	}
+	return string(param)
+}
+
+func (d *OTLPDriver) exportLogs(records []otlpLogRecord) ([]otlpLogRecord, error) {
+	var body []byte
+	if d.config.Encoding == OTLPJSONEncoding {
+		request := map[string]any{
+			"resourceLogs": []any{map[string]any{
+				"resource": map[string]any{"attributes": d.resource},
+				"scopeLogs": []any{map[string]any{
+					"scope":      map[string]string{"name": otlpScopeName},
+					"logRecords": records,
+				}},
+			}},
+		}
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return nil, &permanentError{err: err}
+		}
+	} else {
+		var scopeLogs []byte
+		scopeLogs = protoAppendMessage(scopeLogs, 1, protoAppendString(nil, 1, otlpScopeName))
+		for _, record := range records {
+			scopeLogs = protoAppendMessage(scopeLogs, 2, record.appendProto(nil))
+		}
+		body = d.resourceEnvelope(scopeLogs)
+	}
+
+	_, err := d.sender.post(d.config.URL+otlpLogsPath, body, d.contentType(), nil)
+	return nil, err
+}
+
+func (d *OTLPDriver) exportSpans(spans []otlpSpan) ([]otlpSpan, error) {
+	var body []byte
+	if d.config.Encoding == OTLPJSONEncoding {
+		request := map[string]any{
+			"resourceSpans": []any{map[string]any{
+				"resource": map[string]any{"attributes": d.resource},
+				"scopeSpans": []any{map[string]any{
+					"scope": map[string]string{"name": otlpScopeName},
+					"spans": spans,
+				}},
+			}},
+		}
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return nil, &permanentError{err: err}
+		}
+	} else {
+		var scopeSpans []byte
+		scopeSpans = protoAppendMessage(scopeSpans, 1, protoAppendString(nil, 1, otlpScopeName))
+		for _, span := range spans {
+			scopeSpans = protoAppendMessage(scopeSpans, 2, span.appendProto(nil))
+		}
+		body = d.resourceEnvelope(scopeSpans)
+	}
+
+	_, err := d.sender.post(d.config.URL+otlpTracesPath, body, d.contentType(), nil)
+	return nil, err
+}
+
+// resourceEnvelope wraps the scope message into the Resource{Logs,Spans} of the export request;
+// both requests share the same field numbers
+func (d *OTLPDriver) resourceEnvelope(scope []byte) []byte {
+	var resource []byte
+	for _, kv := range d.resource {
+		resource = protoAppendMessage(resource, 1, kv.appendProto(nil))
+	}
+
+	var resourceItems []byte
+	resourceItems = protoAppendMessage(resourceItems, 1, resource)
+	resourceItems = protoAppendMessage(resourceItems, 2, scope)
+	return protoAppendMessage(nil, 1, resourceItems)
+}
+
+func (d *OTLPDriver) contentType() string {
+	if d.config.Encoding == OTLPJSONEncoding {
+		return "application/json"
+	}
+	return "application/x-protobuf"
+}
+
+// otlpID is a trace or span ID, hex encoded in OTLP/JSON
+type otlpID []byte
+
+func (id otlpID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(id))
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func (v otlpAnyValue) appendProto(b []byte) []byte {
+	return protoAppendString(b, 1, v.StringValue)
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+func (kv otlpKeyValue) appendProto(b []byte) []byte {
+	b = protoAppendString(b, 1, kv.Key)
+	return protoAppendMessage(b, 2, kv.Value.appendProto(nil))
+}
+
+// otlpAttributes returns the attributes sorted by key
+func otlpAttributes(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: attributes[k]}})
+	}
+	return kvs
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         uint64         `json:"timeUnixNano,string"`
+	ObservedTimeUnixNano uint64         `json:"observedTimeUnixNano,string"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID              otlpID         `json:"traceId,omitempty"`
+	SpanID               otlpID         `json:"spanId,omitempty"`
+}
+
+func (r otlpLogRecord) appendProto(b []byte) []byte {
+	b = protoAppendFixed64(b, 1, r.TimeUnixNano)
+	b = protoAppendUint(b, 2, uint64(r.SeverityNumber))
+	b = protoAppendString(b, 3, r.SeverityText)
+	b = protoAppendMessage(b, 5, r.Body.appendProto(nil))
+	for _, kv := range r.Attributes {
+		b = protoAppendMessage(b, 6, kv.appendProto(nil))
+	}
+	b = protoAppendBytes(b, 9, r.TraceID)
+	b = protoAppendBytes(b, 10, r.SpanID)
+	b = protoAppendFixed64(b, 11, r.ObservedTimeUnixNano)
+	return b
+}
+
+type otlpStatus struct {
+	Code int `json:"code"`
+}
+
+type otlpSpan struct {
+	TraceID           otlpID         `json:"traceId"`
+	SpanID            otlpID         `json:"spanId"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,string"`
+	EndTimeUnixNano   uint64         `json:"endTimeUnixNano,string"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+func (s otlpSpan) appendProto(b []byte) []byte {
+	b = protoAppendBytes(b, 1, s.TraceID)
+	b = protoAppendBytes(b, 2, s.SpanID)
+	b = protoAppendString(b, 5, s.Name)
+	b = protoAppendUint(b, 6, uint64(s.Kind))
+	b = protoAppendFixed64(b, 7, s.StartTimeUnixNano)
+	b = protoAppendFixed64(b, 8, s.EndTimeUnixNano)
+	for _, kv := range s.Attributes {
+		b = protoAppendMessage(b, 9, kv.appendProto(nil))
+	}
+	return protoAppendMessage(b, 15, protoAppendUint(nil, 3, uint64(s.Status.Code)))
+}
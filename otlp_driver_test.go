@@ -0,0 +1,126 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type otlpRequest struct {
+	path        string
+	contentType string
+	body        []byte
+	err         error
+}
+
+func newOTLPServer(t *testing.T) (*httptest.Server, chan otlpRequest) {
+	requests := make(chan otlpRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		requests <- otlpRequest{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), body: body, err: err}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestOTLPDriver_JSONLogsAndSpans(t *testing.T) {
+	server, requests := newOTLPServer(t)
+
+	drv, err := (&OTLPDriverFactory{}).CreateDriver(json.RawMessage(`{
+		"url": "` + server.URL + `/",
+		"encoding": "json",
+		"serviceName": "svc",
+		"exportSpans": true
+	}`))
+	require.NoError(t, err)
+
+	drv.BeginTx(7, map[Param]string{"UserID": "123"})
+	drv.Log(map[Param]string{MessageParam: "in tx", LevelParam: "warn", TimeParam: "1700000000", TxIDParam: "7", FileParam: "main.go"})
+	drv.(*OTLPDriver).EndTxWithStatus(7, TxFailed)
+	drv.Stop()
+
+	byPath := map[string]otlpRequest{}
+	for i := 0; i < 2; i++ {
+		req := <-requests
+		require.NoError(t, req.err)
+		require.Equal(t, "application/json", req.contentType)
+		byPath[req.path] = req
+	}
+
+	var logs struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []otlpKeyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				LogRecords []map[string]any `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	require.NoError(t, json.Unmarshal(byPath["/v1/logs"].body, &logs))
+	require.Equal(t, []otlpKeyValue{{Key: "service.name", Value: otlpAnyValue{StringValue: "svc"}}}, logs.ResourceLogs[0].Resource.Attributes)
+	record := logs.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	require.Equal(t, "1700000000000000000", record["timeUnixNano"])
+	require.Equal(t, float64(13), record["severityNumber"])
+	require.Equal(t, "WARN", record["severityText"])
+	require.Equal(t, map[string]any{"stringValue": "in tx"}, record["body"])
+	require.Equal(t, "0000000000000007", record["spanId"])
+	require.Len(t, record["traceId"], 32)
+	require.Equal(t, []any{
+		map[string]any{"key": "code.filepath", "value": map[string]any{"stringValue": "main.go"}},
+		map[string]any{"key": "transaction.id", "value": map[string]any{"stringValue": "7"}},
+	}, record["attributes"])
+
+	var traces struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []map[string]any `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	require.NoError(t, json.Unmarshal(byPath["/v1/traces"].body, &traces))
+	span := traces.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	require.Equal(t, record["traceId"], span["traceId"])
+	require.Equal(t, "0000000000000007", span["spanId"])
+	require.Equal(t, map[string]any{"code": float64(otlpStatusError)}, span["status"])
+	require.Equal(t, []any{map[string]any{"key": "UserID", "value": map[string]any{"stringValue": "123"}}}, span["attributes"])
+}
+
+func TestOTLPDriver_ProtobufLogs(t *testing.T) {
+	server, requests := newOTLPServer(t)
+
+	drv, err := (&OTLPDriverFactory{}).CreateDriver(json.RawMessage(`{"url":"` + server.URL + `","serviceName":"svc"}`))
+	require.NoError(t, err)
+	drv.Log(map[Param]string{MessageParam: "hello", LevelParam: "error", TimeParam: "1700000000", ComponentParam: "db"})
+	drv.Stop()
+
+	req := <-requests
+	require.NoError(t, req.err)
+	require.Equal(t, "/v1/logs", req.path)
+	require.Equal(t, "application/x-protobuf", req.contentType)
+
+	export := parseProto(t, req.body)
+	resourceLogs := parseProto(t, export[1][0].bytes)
+	resource := parseProto(t, resourceLogs[1][0].bytes)
+	serviceName := parseProto(t, resource[1][0].bytes)
+	require.Equal(t, "service.name", string(serviceName[1][0].bytes))
+
+	scopeLogs := parseProto(t, resourceLogs[2][0].bytes)
+	scope := parseProto(t, scopeLogs[1][0].bytes)
+	require.Equal(t, "logsystem", string(scope[1][0].bytes))
+
+	record := parseProto(t, scopeLogs[2][0].bytes)
+	require.Equal(t, uint64(1700000000000000000), record[1][0].varint)
+	require.Equal(t, uint64(17), record[2][0].varint)
+	require.Equal(t, "ERROR", string(record[3][0].bytes))
+	body := parseProto(t, record[5][0].bytes)
+	require.Equal(t, "hello", string(body[1][0].bytes))
+	attribute := parseProto(t, record[6][0].bytes)
+	require.Equal(t, "component", string(attribute[1][0].bytes))
+	require.NotContains(t, record, 9, "no trace id outside transactions")
+}
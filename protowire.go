@@ -0,0 +1,93 @@
+package logsystem
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Minimal protocol buffers encoding, enough for the push APIs of the network drivers
+
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+func protoAppendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+func protoAppendTag(b []byte, field int, wireType int) []byte {
+	return protoAppendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// protoAppendUint appends a varint field; zero values are omitted as in proto3
+func protoAppendUint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protoAppendTag(b, field, protoVarint)
+	return protoAppendVarint(b, v)
+}
+
+func protoAppendFixed64(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protoAppendTag(b, field, protoFixed64)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func protoAppendFixed32(b []byte, field int, v uint32) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protoAppendTag(b, field, protoFixed32)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+func protoAppendDouble(b []byte, field int, v float64) []byte {
+	return protoAppendFixed64(b, field, math.Float64bits(v))
+}
+
+func protoAppendBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return protoAppendMessage(b, field, v)
+}
+
+func protoAppendString(b []byte, field int, v string) []byte {
+	return protoAppendBytes(b, field, []byte(v))
+}
+
+// protoAppendMessage appends an embedded message; unlike scalars, empty messages are kept
+func protoAppendMessage(b []byte, field int, msg []byte) []byte {
+	b = protoAppendTag(b, field, protoBytes)
+	b = protoAppendVarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+// snappyEncode produces a valid snappy block made only of literals. It doesn't compress, but
+// it's what the receivers expecting snappy framing accept, without pulling in a dependency
+func snappyEncode(src []byte) []byte {
+	const maxLiteral = 1 << 16
+
+	dst := binary.AppendUvarint(nil, uint64(len(src)))
+	for len(src) > 0 {
+		n := min(len(src), maxLiteral)
+		l := n - 1
+		switch {
+		case l < 60:
+			dst = append(dst, byte(l)<<2)
+		case l < 1<<8:
+			dst = append(dst, 60<<2, byte(l))
+		default:
+			dst = append(dst, 61<<2, byte(l), byte(l>>8))
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
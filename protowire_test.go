@@ -0,0 +1,81 @@
+package logsystem
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type protoField struct {
+	wireType int
+	varint   uint64
+	bytes    []byte
+}
+
+// parseProto decodes one message level into its fields, keyed by field number
+func parseProto(t *testing.T, b []byte) map[int][]protoField {
+	fields := make(map[int][]protoField)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		require.Greater(t, n, 0)
+		b = b[n:]
+		field := protoField{wireType: int(tag & 7)}
+		switch field.wireType {
+		case protoVarint:
+			field.varint, n = binary.Uvarint(b)
+			require.Greater(t, n, 0)
+			b = b[n:]
+		case protoFixed64:
+			field.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case protoFixed32:
+			field.varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case protoBytes:
+			size, n := binary.Uvarint(b)
+			require.Greater(t, n, 0)
+			field.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", field.wireType)
+		}
+		fields[int(tag>>3)] = append(fields[int(tag>>3)], field)
+	}
+	return fields
+}
+
+// snappyDecodeLiterals decodes the literal-only blocks produced by snappyEncode
+func snappyDecodeLiterals(t *testing.T, src []byte) []byte {
+	size, n := binary.Uvarint(src)
+	require.Greater(t, n, 0)
+	src = src[n:]
+	dst := make([]byte, 0, size)
+	for len(src) > 0 {
+		require.Equal(t, byte(0), src[0]&3, "only literals expected")
+		l := int(src[0] >> 2)
+		src = src[1:]
+		switch l {
+		case 60:
+			l = int(src[0])
+			src = src[1:]
+		case 61:
+			l = int(src[0]) | int(src[1])<<8
+			src = src[2:]
+		}
+		dst = append(dst, src[:l+1]...)
+		src = src[l+1:]
+	}
+	require.Len(t, dst, int(size))
+	return dst
+}
+
+func TestSnappyEncode(t *testing.T) {
+	for _, size := range []int{0, 1, 59, 60, 61, 255, 256, 257, 70000} {
+		src := make([]byte, size)
+		for i := range src {
+			src[i] = byte(i)
+		}
+		require.Equal(t, src, snappyDecodeLiterals(t, snappyEncode(src)))
+	}
+}
@@ -0,0 +1,337 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const RateLimitDriverIDPostfix = "-ratelimit"
+
+const (
+	defaultRateLimitRate            = 10
+	defaultRateLimitSummaryInterval = 10 * time.Second
+	defaultRateLimitMaxKeys         = 10000
+)
+
+// Params of the summary records
+const (
+	SuppressedParam      Param = "suppressed"
+	MessageTemplateParam Param = "messageTemplate"
+)
+
+type rateLimitConfig struct {
+	RatePerSec        *float64             `json:"ratePerSec"`        // records per second per component, level and message template, 0 disables the limit; default 10
+	Burst             int                  `json:"burst"`             // records allowed at once; defaults to ratePerSec
+	SampleRates       map[LogLevel]float64 `json:"sampleRates"`       // share of the records kept per level, 0 to 1; other levels are kept
+	SummaryIntervalMs int                  `json:"summaryIntervalMs"` // how often the suppressed counts are reported; default 10000
+	MaxKeys           int                  `json:"maxKeys"`           // rate limited keys tracked, the least recently seen is forgotten when reached; default 10000
+	Driver            json.RawMessage      `json:"driver"`            // config of the wrapped driver
+}
+
+// RateLimitDriverFactory implements DriverFactoryInterface
+type RateLimitDriverFactory struct {
+	provider DriverFactoryInterface
+}
+
+func NewRateLimitDriverFactory(provider DriverFactoryInterface) *RateLimitDriverFactory {
+	return &RateLimitDriverFactory{
+		provider: provider,
+	}
+}
+
+func (f *RateLimitDriverFactory) DriverID() DriverID {
+	return DriverID(string(f.provider.DriverID()) + RateLimitDriverIDPostfix)
+}
+
+func (f *RateLimitDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var limitConfig rateLimitConfig
+	err := json.Unmarshal(config, &limitConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rate limit driver config: %w", err)
+	}
+	rate := float64(defaultRateLimitRate)
+	if limitConfig.RatePerSec != nil {
+		rate = *limitConfig.RatePerSec
+	}
+	if rate < 0 {
+		return nil, fmt.Errorf("rate limit must not be negative")
+	}
+	for level, rate := range limitConfig.SampleRates {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("sample rate of level %s must be between 0 and 1", level)
+		}
+	}
+	if len(limitConfig.Driver) == 0 {
+		limitConfig.Driver = json.RawMessage("{}")
+	}
+
+	provider, err := f.provider.CreateDriver(limitConfig.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := defaultRateLimitSummaryInterval
+	if limitConfig.SummaryIntervalMs > 0 {
+		interval = time.Duration(limitConfig.SummaryIntervalMs) * time.Millisecond
+	}
+	d := NewRateLimitDriver(provider, rate, limitConfig.Burst, interval)
+	d.sampleRates = limitConfig.SampleRates
+	if limitConfig.MaxKeys > 0 {
+		d.maxKeys = limitConfig.MaxKeys
+	}
+	return d, nil
+}
+
+type rateLimitKey struct {
+	component string
+	level     string
+	template  string
+}
+
+type tokenBucket struct {
+	tokens     float64
+	last       time.Time // of the last refill
+	seen       time.Time // of the last record
+	suppressed int
+}
+
+// RateLimitDriver implements DriverInterface
+// It drops the records exceeding a token bucket per component, level and message template, and
+// samples the records per level. The number of suppressed records of each key is reported to
+// the wrapped driver periodically. Transaction begin and end events are always forwarded. The
+// wrapped driver is called under the mutex, the summaries being sent from a goroutine
+type RateLimitDriver struct {
+	provider    DriverInterface
+	rate        float64
+	burst       float64
+	sampleRates map[LogLevel]float64
+	maxKeys     int
+
+	now    func() time.Time
+	sample func() float64
+
+	mutex   sync.Mutex
+	buckets map[rateLimitKey]*tokenBucket
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewRateLimitDriver allows rate records per second per key, with bursts up to burst records;
+// a burst below 1 defaults to rate and a rate of 0 only samples. The summaries are sent every
+// summaryInterval
+func NewRateLimitDriver(provider DriverInterface, rate float64, burst int, summaryInterval time.Duration) *RateLimitDriver {
+	d := &RateLimitDriver{
+		provider: provider,
+		rate:     rate,
+		burst:    float64(burst),
+		maxKeys:  defaultRateLimitMaxKeys,
+		now:      time.Now,
+		sample:   rand.Float64,
+		buckets:  make(map[rateLimitKey]*tokenBucket),
+		done:     make(chan struct{}),
+	}
+	if d.burst < 1 {
+		d.burst = max(rate, 1)
+	}
+
+	d.wg.Add(1)
+	go d.run(summaryInterval)
+	return d
+}
+
+func (d *RateLimitDriver) Log(data map[Param]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.allow(data) {
+		d.provider.Log(data)
+	}
+}
+
+// allow is called under the mutex
+func (d *RateLimitDriver) allow(data map[Param]string) bool {
+	key := rateLimitKey{
+		component: data[ComponentParam],
+		level:     data[LevelParam],
+		template:  messageTemplate(data[MessageParam]),
+	}
+
+	now := d.now()
+	bucket, ok := d.buckets[key]
+	if !ok {
+		if len(d.buckets) >= d.maxKeys {
+			d.evictOldest()
+		}
+		bucket = &tokenBucket{tokens: d.burst, last: now}
+		d.buckets[key] = bucket
+	}
+	bucket.seen = now
+
+	if rate, ok := d.sampleRates[LogLevel(key.level)]; ok && d.sample() >= rate {
+		bucket.suppressed++
+		return false
+	}
+	if d.rate == 0 {
+		return true
+	}
+
+	bucket.tokens = min(d.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*d.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		bucket.suppressed++
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// evictOldest forgets the least recently seen key, reporting its suppressed records; called under
+// the mutex
+func (d *RateLimitDriver) evictOldest() {
+	var oldest rateLimitKey
+	var oldestBucket *tokenBucket
+	for key, bucket := range d.buckets {
+		if oldestBucket == nil || bucket.seen.Before(oldestBucket.seen) {
+			oldest, oldestBucket = key, bucket
+		}
+	}
+	if oldestBucket == nil {
+		return
+	}
+	if oldestBucket.suppressed > 0 {
+		d.provider.Log(suppressedSummary(oldest, oldestBucket.suppressed, d.now()))
+	}
+	delete(d.buckets, oldest)
+}
+
+// messageTemplate replaces the numbers of the message, so that messages differing only by
+// IDs or counts share a key
+func messageTemplate(message string) string {
+	var sb strings.Builder
+	inNumber := false
+	for _, r := range message {
+		if unicode.IsDigit(r) {
+			if !inNumber {
+				sb.WriteByte('#')
+			}
+			inNumber = true
+			continue
+		}
+		inNumber = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func (d *RateLimitDriver) BeginTx(id TxID, attr map[Param]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.provider.BeginTx(id, attr)
+}
+
+func (d *RateLimitDriver) EndTx(id TxID) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.provider.EndTx(id)
+}
+
+func (d *RateLimitDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	endTxWithStatus(d.provider, id, status)
+}
+
+func (d *RateLimitDriver) Flush() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	flushDriver(d.provider)
+}
+
+func (d *RateLimitDriver) Dump() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	dumpDriver(d.provider)
+}
+
+func (d *RateLimitDriver) SetErrorHandler(handler func(err error)) {
+	setErrorHandler(d.provider, handler)
+}
+
+func (d *RateLimitDriver) Health() error {
+	return driverHealth(d.provider)
+}
+
+// ReportsErrorsAsync is the one of the wrapped driver
+func (d *RateLimitDriver) ReportsErrorsAsync() bool {
+	return reportsErrorsAsync(d.provider)
+}
+
+// Stop reports the suppressed records not reported yet and stops the wrapped driver; later calls
+// do nothing
+func (d *RateLimitDriver) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+		d.wg.Wait()
+		d.reportSuppressed()
+		d.provider.Stop()
+	})
+}
+
+func (d *RateLimitDriver) run(interval time.Duration) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.reportSuppressed()
+		}
+	}
+}
+
+// reportSuppressed sends a summary record per key with suppressed records and forgets the
+// idle keys
+func (d *RateLimitDriver) reportSuppressed() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
+	for key, bucket := range d.buckets {
+		if bucket.suppressed == 0 {
+			if bucket.tokens+now.Sub(bucket.last).Seconds()*d.rate >= d.burst {
+				delete(d.buckets, key)
+			}
+			continue
+		}
+		summary := suppressedSummary(key, bucket.suppressed, now)
+		bucket.suppressed = 0
+		d.provider.Log(summary)
+	}
+}
+
+func suppressedSummary(key rateLimitKey, suppressed int, now time.Time) map[Param]string {
+	summary := map[Param]string{
+		MessageParam:         fmt.Sprintf("Suppressed %d similar messages: %s", suppressed, key.template),
+		TimeParam:            strconv.FormatInt(now.Unix(), 10),
+		SuppressedParam:      strconv.Itoa(suppressed),
+		MessageTemplateParam: key.template,
+	}
+	if key.level != "" {
+		summary[LevelParam] = key.level
+	}
+	if key.component != "" {
+		summary[ComponentParam] = key.component
+	}
+	return summary
+}
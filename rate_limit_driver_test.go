@@ -0,0 +1,179 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageTemplate(t *testing.T) {
+	require.Equal(t, "user # failed after # retries", messageTemplate("user 1234 failed after 3 retries"))
+	require.Equal(t, "disk full", messageTemplate("disk full"))
+	require.Equal(t, "#.#.#.#:#", messageTemplate("10.0.0.1:8080"))
+}
+
+func TestRateLimitDriver_TokenBucket(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewRateLimitDriver(provider, 1, 2, time.Hour)
+	now := time.Unix(100, 0)
+	drv.now = func() time.Time { return now }
+
+	warn := func(message string) {
+		drv.Log(map[Param]string{MessageParam: message, LevelParam: string(Warn), ComponentParam: "disk"})
+	}
+	for i := 0; i < 5; i++ {
+		warn("retry " + strconv.Itoa(i))
+	}
+	// Other keys have their own bucket
+	drv.Log(map[Param]string{MessageParam: "retry 9", LevelParam: string(Error), ComponentParam: "disk"})
+	require.Equal(t, []string{"retry 0", "retry 1", "retry 9"}, messages(provider.Records()))
+
+	// One token per second
+	now = now.Add(1500 * time.Millisecond)
+	warn("retry 5")
+	warn("retry 6")
+	require.Equal(t, "retry 5", provider.Records()[3][MessageParam])
+	require.Len(t, provider.Records(), 4)
+
+	drv.reportSuppressed()
+	summary := provider.Records()[4]
+	require.Equal(t, "Suppressed 4 similar messages: retry #", summary[MessageParam])
+	require.Equal(t, "4", summary[SuppressedParam])
+	require.Equal(t, "retry #", summary[MessageTemplateParam])
+	require.Equal(t, string(Warn), summary[LevelParam])
+	require.Equal(t, "disk", summary[ComponentParam])
+
+	// Nothing new to report; the idle Error key is forgotten once its bucket refilled
+	now = now.Add(time.Minute)
+	drv.reportSuppressed()
+	require.Len(t, provider.Records(), 5)
+	require.Empty(t, drv.buckets)
+
+	drv.Stop()
+	require.True(t, provider.stopped)
+}
+
+func TestRateLimitDriver_SamplingAndTransactions(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewRateLimitDriver(provider, 1000, 0, time.Hour)
+	drv.sampleRates = map[LogLevel]float64{Debug: 0.25}
+	samples := []float64{0.1, 0.5, 0.9, 0.2}
+	drv.sample = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+
+	drv.BeginTx(1, nil)
+	for _, message := range []string{"a", "b", "c", "d"} {
+		drv.Log(map[Param]string{MessageParam: message, LevelParam: string(Debug), TxIDParam: "1"})
+	}
+	drv.Log(map[Param]string{MessageParam: "info", LevelParam: string(Info)})
+	drv.EndTxWithStatus(1, TxSucceeded)
+	require.Equal(t, []string{"a", "d", "info"}, messages(provider.Records()))
+	require.Equal(t, []TxID{1}, provider.begins)
+	require.Equal(t, TxSucceeded, provider.Status(1))
+
+	drv.Stop()
+	var summaries []string
+	for _, record := range provider.Records()[3:] {
+		summaries = append(summaries, record[MessageParam])
+	}
+	sort.Strings(summaries)
+	require.Equal(t, []string{"Suppressed 1 similar messages: b", "Suppressed 1 similar messages: c"}, summaries)
+}
+
+func TestRateLimitDriver_MaxKeys(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewRateLimitDriver(provider, 1, 1, time.Hour)
+	drv.maxKeys = 2
+	drv.sampleRates = map[LogLevel]float64{Debug: 0}
+	now := time.Unix(1000, 0)
+	drv.now = func() time.Time { return now }
+	defer drv.Stop()
+
+	for _, message := range []string{"a", "b"} {
+		drv.Log(map[Param]string{MessageParam: message})
+		drv.Log(map[Param]string{MessageParam: message})
+		now = now.Add(time.Millisecond)
+	}
+	// The least recently seen key is forgotten; the new keys are limited
+	drv.Log(map[Param]string{MessageParam: "c"})
+	drv.Log(map[Param]string{MessageParam: "c"})
+	now = now.Add(time.Millisecond)
+	// and sampled
+	drv.Log(map[Param]string{MessageParam: "d", LevelParam: string(Debug)})
+
+	require.Equal(t, []string{"a", "b", "Suppressed 1 similar messages: a", "c", "Suppressed 1 similar messages: b"}, messages(provider.Records()))
+	require.Len(t, drv.buckets, 2)
+}
+
+func TestRateLimitDriver_PeriodicSummary(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewRateLimitDriver(provider, 1, 1, 10*time.Millisecond)
+	defer drv.Stop()
+
+	drv.Log(map[Param]string{MessageParam: "flood"})
+	drv.Log(map[Param]string{MessageParam: "flood"})
+	require.Eventually(t, func() bool {
+		return len(provider.Records()) == 2
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, "1", provider.Records()[1][SuppressedParam])
+}
+
+func TestRateLimitDriverFactory(t *testing.T) {
+	provider := &RecordingDriver{}
+	factory := NewRateLimitDriverFactory(&RecordingDriverFactory{id: "recording", driver: provider})
+	require.Equal(t, DriverID("recording-ratelimit"), factory.DriverID())
+
+	drv, err := factory.CreateDriver(json.RawMessage(`{"ratePerSec":5,"sampleRates":{"debug":0.1},"driver":{}}`))
+	require.NoError(t, err)
+	limiter := drv.(*RateLimitDriver)
+	require.Equal(t, 5.0, limiter.rate)
+	require.Equal(t, 5.0, limiter.burst)
+	require.Equal(t, 0.1, limiter.sampleRates[Debug])
+	drv.Stop()
+
+	// Sampling only
+	drv, err = factory.CreateDriver(json.RawMessage(`{"ratePerSec":0,"sampleRates":{"debug":0},"driver":{}}`))
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		drv.Log(map[Param]string{MessageParam: "kept", LevelParam: string(Info)})
+		drv.Log(map[Param]string{MessageParam: "dropped", LevelParam: string(Debug)})
+	}
+	require.Len(t, provider.Records(), 100)
+	drv.Stop()
+	drv.Stop()
+
+	for _, config := range []string{`{"ratePerSec":-1}`, `{"sampleRates":{"info":1.5}}`} {
+		_, err = factory.CreateDriver(json.RawMessage(config))
+		require.Error(t, err, config)
+	}
+}
+
+// unsyncedDriver counts the records without synchronization, for the race detector to catch
+// concurrent calls
+type unsyncedDriver struct {
+	RecordingDriver
+	count int
+}
+
+func (d *unsyncedDriver) Log(data map[Param]string) {
+	d.count++
+}
+
+func TestRateLimitDriver_SerializesProviderCalls(t *testing.T) {
+	provider := &unsyncedDriver{}
+	drv := NewRateLimitDriver(provider, 10000, 1, time.Millisecond)
+
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		drv.Log(map[Param]string{MessageParam: "flood"})
+	}
+	drv.Stop()
+	require.Positive(t, provider.count)
+}
@@ -0,0 +1,116 @@
+package logsystem
+
+import (
+	"fmt"
+	"sync"
+)
+
+var panicFlush struct {
+	mutex   sync.Mutex
+	loggers []*Logger
+}
+
+// Recover is meant to be deferred; it logs a panic at Error with the stack trace and ends the
+// transaction as failed. The panic doesn't propagate further
+func (tl TxLogger) Recover() {
+	if r := recover(); r != nil {
+		tl.handlePanic(r, false)
+	}
+}
+
+// RecoverAndRepanic behaves like Recover and then re-panics after flushing the registered loggers
+func (tl TxLogger) RecoverAndRepanic() {
+	if r := recover(); r != nil {
+		tl.handlePanic(r, true)
+	}
+}
+
+// Go runs fn in a new goroutine owning tx. A panic is logged and ends tx as failed; otherwise
+// tx ends as succeeded when fn returns
+func Go(tx TxLogger, fn func()) {
+	go runTx(tx, fn, false)
+}
+
+// GoAndRepanic behaves like Go and then re-panics, which terminates the process
+func GoAndRepanic(tx TxLogger, fn func()) {
+	go runTx(tx, fn, true)
+}
+
+func runTx(tx TxLogger, fn func(), repanic bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			tx.handlePanic(r, repanic)
+			return
+		}
+		tx.EndTxWithStatus(TxSucceeded)
+	}()
+	fn()
+}
+
+func (tl TxLogger) handlePanic(r any, repanic bool) {
+	params := panicParams(r, panicStackTrace())
+	tl.logAttrib(fmt.Sprintf("panic: %v", r), Error, params)
+	tl.EndTxWithStatus(TxFailed)
+
+	if repanic {
+		flushOnPanic(tl.logger)
+		panic(r)
+	}
+}
+
+// RegisterPanicFlush adds l to the loggers that are flushed before a panic terminates the process,
+// see HandlePanic and RecoverAndRepanic
+func RegisterPanicFlush(l *Logger) {
+	panicFlush.mutex.Lock()
+	defer panicFlush.mutex.Unlock()
+	for _, registered := range panicFlush.loggers {
+		if registered == l {
+			return
+		}
+	}
+	panicFlush.loggers = append(panicFlush.loggers, l)
+}
+
+// HandlePanic is meant to be deferred at the top of main; it logs an unrecovered panic to the
+// registered loggers, flushes them and re-panics
+func HandlePanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	params := panicParams(r, panicStackTrace())
+	message := fmt.Sprintf("panic: %v", r)
+	for _, l := range registeredPanicLoggers() {
+		l.logAttrib(message, Error, params)
+	}
+	flushOnPanic(nil)
+	panic(r)
+}
+
+func panicParams(r any, stack string) map[Param]string {
+	params := map[Param]string{}
+	if err, ok := r.(error); ok {
+		params = errorParams(err)
+	}
+	params[StackParam] = stack
+	return params
+}
+
+func registeredPanicLoggers() []*Logger {
+	panicFlush.mutex.Lock()
+	defer panicFlush.mutex.Unlock()
+	return append([]*Logger{}, panicFlush.loggers...)
+}
+
+// flushOnPanic flushes the registered loggers and extra, if not registered
+func flushOnPanic(extra *Logger) {
+	flushed := false
+	for _, l := range registeredPanicLoggers() {
+		l.Flush()
+		flushed = flushed || l == extra
+	}
+	if extra != nil && !flushed {
+		extra.Flush()
+	}
+}
@@ -0,0 +1,104 @@
+package logsystem
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxLogger_Recover(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{})
+	tx := l.BeginTx(nil)
+
+	func() {
+		defer tx.Recover()
+		panic(errors.New("boom"))
+	}()
+
+	records := drv.Records()
+	require.Len(t, records, 1)
+	require.Equal(t, "panic: boom", records[0][MessageParam])
+	require.Equal(t, string(Error), records[0][LevelParam])
+	require.Equal(t, "boom", records[0][ErrorParam])
+	require.NotContains(t, records[0][StackParam], "runtime.gopanic")
+	require.Contains(t, records[0][StackParam], "logsystem.TestTxLogger_Recover.func1")
+	require.Equal(t, TxFailed, drv.Status(tx.txID))
+}
+
+func TestTxLogger_RecoverAndRepanic(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{})
+	tx := l.BeginTx(nil)
+
+	recovered := func() (r any) {
+		defer func() {
+			r = recover()
+		}()
+		defer tx.RecoverAndRepanic()
+		panic("boom")
+	}()
+
+	require.Equal(t, "boom", recovered)
+	require.Equal(t, TxFailed, drv.Status(tx.txID))
+	require.Equal(t, 1, drv.flushes)
+}
+
+func TestGo(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{})
+
+	done := make(chan struct{})
+	okTx := l.BeginTx(nil)
+	Go(okTx, func() {
+		close(done)
+	})
+	failedTx := l.BeginTx(nil)
+	Go(failedTx, func() {
+		<-done
+		panic("boom")
+	})
+
+	require.Eventually(t, func() bool {
+		return drv.Status(okTx.txID) != "" && drv.Status(failedTx.txID) != ""
+	}, time.Second, time.Millisecond)
+	require.Equal(t, TxSucceeded, drv.Status(okTx.txID))
+	require.Equal(t, TxFailed, drv.Status(failedTx.txID))
+}
+
+func panicking() {
+	panic("boom")
+}
+
+func TestPanicStack_StartsAtPanickingFunction(t *testing.T) {
+	l, drv := newRecordingLogger(LoggerConfig{})
+	panicFlush.mutex.Lock()
+	registered := panicFlush.loggers
+	panicFlush.loggers = []*Logger{l}
+	panicFlush.mutex.Unlock()
+	defer func() {
+		panicFlush.mutex.Lock()
+		panicFlush.loggers = registered
+		panicFlush.mutex.Unlock()
+	}()
+
+	func() {
+		defer l.BeginTx(nil).Recover()
+		panicking()
+	}()
+	runTx(l.BeginTx(nil), panicking, false)
+	func() {
+		defer func() {
+			recover()
+		}()
+		defer HandlePanic()
+		panicking()
+	}()
+
+	records := drv.Records()
+	require.Len(t, records, 3)
+	for _, record := range records {
+		top, _, _ := strings.Cut(record[StackParam], "\n")
+		require.Equal(t, "logsystem.panicking", top)
+	}
+}
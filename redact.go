@@ -0,0 +1,280 @@
+package logsystem
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const (
+	MaskRedaction     = "mask"
+	HashRedaction     = "hash"
+	TruncateRedaction = "truncate"
+	DropRedaction     = "drop"
+)
+
+const (
+	defaultRedactionMask = "[REDACTED]"
+	// hex characters kept of the HMAC-SHA256
+	redactionHashLength = 32
+)
+
+type redactConfig struct {
+	HMACKey    string       `json:"hmacKey"`    // key of the hash action
+	HMACKeyEnv string       `json:"hmacKeyEnv"` // environment variable holding the key, instead of hmacKey
+	Rules      []redactRule `json:"rules"`
+}
+
+type redactRule struct {
+	Keys    []Param `json:"keys"`    // params the rule applies to; all but time, level and txID by default with a pattern
+	Pattern string  `json:"pattern"` // redact the matches only, instead of the whole value
+	Action  string  `json:"action"`  // "mask", "hash", "truncate" or "drop"
+	Mask    string  `json:"mask"`    // replacement of the mask action; default [REDACTED]
+	Length  int     `json:"length"`  // characters kept by the truncate action
+}
+
+type compiledRedactRule struct {
+	redactRule
+	keys    map[Param]bool
+	pattern *regexp.Regexp
+}
+
+// Redactor applies redaction rules to the params of records and transaction attributes
+type Redactor struct {
+	hmacKey []byte
+	rules   []compiledRedactRule
+}
+
+func newRedactor(config redactConfig) (*Redactor, error) {
+	r := &Redactor{
+		hmacKey: []byte(config.HMACKey),
+	}
+	if config.HMACKeyEnv != "" {
+		r.hmacKey = []byte(os.Getenv(config.HMACKeyEnv))
+	}
+
+	for i, rule := range config.Rules {
+		compiled := compiledRedactRule{redactRule: rule}
+		switch rule.Action {
+		case MaskRedaction:
+			if compiled.Mask == "" {
+				compiled.Mask = defaultRedactionMask
+			}
+		case HashRedaction:
+			if len(r.hmacKey) == 0 {
+				return nil, fmt.Errorf("redact rule %d: the hash action requires an HMAC key", i)
+			}
+		case TruncateRedaction:
+			if rule.Length < 0 {
+				return nil, fmt.Errorf("redact rule %d: negative truncate length", i)
+			}
+		case DropRedaction:
+		default:
+			return nil, fmt.Errorf("redact rule %d: unknown action %q", i, rule.Action)
+		}
+
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redact rule %d: %w", i, err)
+			}
+			compiled.pattern = pattern
+		} else if len(rule.Keys) == 0 {
+			return nil, fmt.Errorf("redact rule %d: keys or pattern required", i)
+		}
+		if len(rule.Keys) > 0 {
+			compiled.keys = make(map[Param]bool, len(rule.Keys))
+			for _, key := range rule.Keys {
+				compiled.keys[key] = true
+			}
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// Redact returns a redacted copy of data; data itself is shared with the other drivers and
+// isn't modified. The rules applying to the error and the params apply to the messages and the
+// params of the error chain too, unless a rule names the chain itself
+func (r *Redactor) Redact(data map[Param]string) map[Param]string {
+	redacted := make(map[Param]string, len(data))
+	for k, v := range data {
+		redacted[k] = v
+	}
+	var chain *ErrorNode
+	if val, ok := redacted[ErrorChainParam]; ok {
+		var node ErrorNode
+		if json.Unmarshal([]byte(val), &node) == nil {
+			chain = &node
+		}
+	}
+
+	for _, rule := range r.rules {
+		if chain != nil && rule.keys[ErrorChainParam] {
+			// Redacted as a whole from now on
+			chain = nil
+		}
+		for k, v := range redacted {
+			if !rule.appliesTo(k) || (k == ErrorChainParam && chain != nil) {
+				continue
+			}
+			value, keep := r.redactValue(rule, v)
+			if !keep {
+				delete(redacted, k)
+				continue
+			}
+			redacted[k] = value
+		}
+		if chain != nil {
+			r.redactErrorNode(rule, chain)
+		}
+	}
+
+	if chain != nil {
+		if encoded, err := json.Marshal(chain); err == nil {
+			redacted[ErrorChainParam] = string(encoded)
+		}
+	}
+	return redacted
+}
+
+// redactValue returns the value redacted by the rule; false if the rule drops it
+func (r *Redactor) redactValue(rule compiledRedactRule, value string) (string, bool) {
+	if rule.pattern == nil {
+		if rule.Action == DropRedaction {
+			return "", false
+		}
+		return r.apply(rule, value), true
+	}
+	return rule.pattern.ReplaceAllStringFunc(value, func(match string) string {
+		if rule.Action == DropRedaction {
+			return ""
+		}
+		return r.apply(rule, match)
+	}), true
+}
+
+// redactErrorNode applies the rule to the messages of the chain as to the error, and to the
+// params of the chain as to the record params
+func (r *Redactor) redactErrorNode(rule compiledRedactRule, node *ErrorNode) {
+	if rule.appliesTo(ErrorParam) {
+		node.Message, _ = r.redactValue(rule, node.Message)
+	}
+	for k, v := range node.Params {
+		if !rule.appliesTo(k) {
+			continue
+		}
+		value, keep := r.redactValue(rule, v)
+		if !keep {
+			delete(node.Params, k)
+			continue
+		}
+		node.Params[k] = value
+	}
+	for i := range node.Wrapped {
+		r.redactErrorNode(rule, &node.Wrapped[i])
+	}
+}
+
+func (rule compiledRedactRule) appliesTo(key Param) bool {
+	if rule.keys != nil {
+		return rule.keys[key]
+	}
+	// Patterns don't apply to the structural params by default
+	return key != TimeParam && key != LevelParam && key != TxIDParam
+}
+
+func (r *Redactor) apply(rule compiledRedactRule, value string) string {
+	switch rule.Action {
+	case MaskRedaction:
+		return rule.Mask
+	case HashRedaction:
+		mac := hmac.New(sha256.New, r.hmacKey)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))[:redactionHashLength]
+	case TruncateRedaction:
+		runes := []rune(value)
+		if len(runes) > rule.Length {
+			return string(runes[:rule.Length])
+		}
+	}
+	return value
+}
+
+// withRedaction wraps the driver by RedactDriver when its config has redaction rules under the
+// "redact" key
+func withRedaction(driver DriverInterface, config json.RawMessage) (DriverInterface, error) {
+	var wrapper struct {
+		Redact *redactConfig `json:"redact"`
+	}
+	// Drivers accept configs that aren't objects; those have no rules
+	if json.Unmarshal(config, &wrapper) != nil || wrapper.Redact == nil {
+		return driver, nil
+	}
+
+	redactor, err := newRedactor(*wrapper.Redact)
+	if err != nil {
+		driver.Stop()
+		return nil, fmt.Errorf("invalid redact config: %w", err)
+	}
+	return NewRedactDriver(driver, redactor), nil
+}
+
+// RedactDriver implements DriverInterface
+// It redacts the records and the transaction attributes before they reach the wrapped driver
+type RedactDriver struct {
+	provider DriverInterface
+	redactor *Redactor
+}
+
+func NewRedactDriver(provider DriverInterface, redactor *Redactor) *RedactDriver {
+	return &RedactDriver{
+		provider: provider,
+		redactor: redactor,
+	}
+}
+
+func (d *RedactDriver) Log(data map[Param]string) {
+	d.provider.Log(d.redactor.Redact(data))
+}
+
+func (d *RedactDriver) BeginTx(id TxID, attr map[Param]string) {
+	d.provider.BeginTx(id, d.redactor.Redact(attr))
+}
+
+func (d *RedactDriver) EndTx(id TxID) {
+	d.provider.EndTx(id)
+}
+
+func (d *RedactDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	endTxWithStatus(d.provider, id, status)
+}
+
+func (d *RedactDriver) Flush() {
+	flushDriver(d.provider)
+}
+
+func (d *RedactDriver) Dump() {
+	dumpDriver(d.provider)
+}
+
+func (d *RedactDriver) SetErrorHandler(handler func(err error)) {
+	setErrorHandler(d.provider, handler)
+}
+
+func (d *RedactDriver) Health() error {
+	return driverHealth(d.provider)
+}
+
+// ReportsErrorsAsync is the one of the wrapped driver
+func (d *RedactDriver) ReportsErrorsAsync() bool {
+	return reportsErrorsAsync(d.provider)
+}
+
+func (d *RedactDriver) Stop() {
+	d.provider.Stop()
+}
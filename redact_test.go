@@ -0,0 +1,147 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedactor(t *testing.T, config string) *Redactor {
+	var redactConfig redactConfig
+	require.NoError(t, json.Unmarshal([]byte(config), &redactConfig))
+	redactor, err := newRedactor(redactConfig)
+	require.NoError(t, err)
+	return redactor
+}
+
+func TestRedactor_Actions(t *testing.T) {
+	redactor := newTestRedactor(t, `{"hmacKey":"secret","rules":[
+		{"keys":["UserID"],"action":"hash"},
+		{"keys":["password"],"action":"drop"},
+		{"keys":["stack"],"action":"truncate","length":5},
+		{"pattern":"[\\w.]+@[\\w.]+","action":"mask","mask":"<email>"},
+		{"pattern":"card \\d+","action":"drop"}
+	]}`)
+
+	data := map[Param]string{
+		MessageParam: "mail to jane@example.com failed, card 4111 declined",
+		TimeParam:    "100",
+		"UserID":     "42",
+		"password":   "hunter2",
+		"stack":      "main.go:10",
+		"email":      "joe@example.com",
+	}
+	redacted := redactor.Redact(data)
+
+	require.Equal(t, map[Param]string{
+		MessageParam: "mail to <email> failed,  declined",
+		TimeParam:    "100",
+		"UserID":     redactor.Redact(map[Param]string{"UserID": "42"})["UserID"],
+		"stack":      "main.",
+		"email":      "<email>",
+	}, redacted)
+	require.Len(t, redacted["UserID"], redactionHashLength)
+	require.NotEqual(t, redacted["UserID"], redactor.Redact(map[Param]string{"UserID": "43"})["UserID"])
+	// The record is shared with the other drivers
+	require.Equal(t, "hunter2", data["password"])
+}
+
+func TestRedactor_ErrorChain(t *testing.T) {
+	err := fmt.Errorf("login failed: %w", errors.Join(&codedError{code: "bob@example.com"}, errors.New("user bob@example.com not found")))
+	data := errorParams(err)
+
+	chainOf := func(redacted map[Param]string) ErrorNode {
+		var chain ErrorNode
+		require.NoError(t, json.Unmarshal([]byte(redacted[ErrorChainParam]), &chain))
+		require.NotContains(t, redacted[ErrorChainParam], "bob@")
+		return chain
+	}
+
+	// A key rule on the error masks the messages of the chain
+	redacted := newTestRedactor(t, `{"rules":[{"keys":["error"],"action":"mask"},{"keys":["code"],"action":"drop"}]}`).Redact(data)
+	require.Equal(t, defaultRedactionMask, redacted[ErrorParam])
+	require.NotContains(t, redacted, Param("code"))
+	chain := chainOf(redacted)
+	require.Equal(t, defaultRedactionMask, chain.Message)
+	require.Equal(t, defaultRedactionMask, chain.Wrapped[0].Wrapped[0].Message)
+	require.Empty(t, chain.Wrapped[0].Wrapped[0].Params)
+	require.Equal(t, defaultRedactionMask, chain.Wrapped[0].Wrapped[1].Message)
+
+	// A pattern rule applies to the messages and params, the chain staying valid JSON
+	redacted = newTestRedactor(t, `{"rules":[{"pattern":"[\\w.]+@[\\w.]+","action":"mask","mask":"<email>"}]}`).Redact(data)
+	chain = chainOf(redacted)
+	require.Equal(t, "login failed: coded <email>\nuser <email> not found", chain.Message)
+	require.Equal(t, "user <email> not found", chain.Wrapped[0].Wrapped[1].Message)
+	require.Equal(t, map[Param]string{"code": "<email>"}, chain.Wrapped[0].Wrapped[0].Params)
+
+	// A rule on the chain itself redacts it whole
+	redacted = newTestRedactor(t, `{"rules":[{"keys":["errorChain"],"action":"mask"},{"keys":["error"],"action":"mask"}]}`).Redact(data)
+	require.Equal(t, defaultRedactionMask, redacted[ErrorChainParam])
+}
+
+func TestRedactor_HMACKeyEnv(t *testing.T) {
+	t.Setenv("REDACT_TEST_KEY", "one")
+	first := newTestRedactor(t, `{"hmacKeyEnv":"REDACT_TEST_KEY","rules":[{"keys":["UserID"],"action":"hash"}]}`)
+	t.Setenv("REDACT_TEST_KEY", "two")
+	second := newTestRedactor(t, `{"hmacKeyEnv":"REDACT_TEST_KEY","rules":[{"keys":["UserID"],"action":"hash"}]}`)
+
+	data := map[Param]string{"UserID": "42"}
+	require.NotEqual(t, first.Redact(data)["UserID"], second.Redact(data)["UserID"])
+}
+
+func TestRedactor_InvalidConfig(t *testing.T) {
+	for _, config := range []redactConfig{
+		{Rules: []redactRule{{Keys: []Param{"UserID"}, Action: HashRedaction}}},
+		{Rules: []redactRule{{Keys: []Param{"UserID"}, Action: "encrypt"}}},
+		{Rules: []redactRule{{Action: MaskRedaction}}},
+		{Rules: []redactRule{{Pattern: "(", Action: MaskRedaction}}},
+		{Rules: []redactRule{{Keys: []Param{"stack"}, Action: TruncateRedaction, Length: -1}}},
+	} {
+		_, err := newRedactor(config)
+		require.Error(t, err)
+	}
+}
+
+func TestRedactDriver_PerDriver(t *testing.T) {
+	local := &RecordingDriver{}
+	remote := &RecordingDriver{}
+	factories := []DriverFactoryInterface{
+		&RecordingDriverFactory{id: "local", driver: local},
+		&RecordingDriverFactory{id: "remote", driver: remote},
+	}
+	config := Config{Drivers: map[DriverID]json.RawMessage{
+		"local":  json.RawMessage(`{}`),
+		"remote": json.RawMessage(`{"redact":{"rules":[{"keys":["UserID"],"action":"mask"}]}}`),
+	}}
+
+	mgr, err := CreateLogManagerWithConfig(factories, config)
+	require.NoError(t, err)
+
+	id := mgr.beginTx(map[Param]string{"UserID": "42"})
+	mgr.log(map[Param]string{MessageParam: "login", "UserID": "42"})
+	mgr.endTxWithStatus(id, TxFailed)
+	mgr.stop()
+
+	require.Equal(t, "42", local.attrs[id]["UserID"])
+	require.Equal(t, "42", local.Records()[0]["UserID"])
+	require.Equal(t, defaultRedactionMask, remote.attrs[id]["UserID"])
+	require.Equal(t, defaultRedactionMask, remote.Records()[0]["UserID"])
+	require.Equal(t, TxFailed, remote.Status(id))
+	require.True(t, remote.stopped)
+}
+
+func TestRedactDriver_InvalidConfig(t *testing.T) {
+	drv := &RecordingDriver{}
+	factories := []DriverFactoryInterface{&RecordingDriverFactory{id: "remote", driver: drv}}
+	config := Config{Drivers: map[DriverID]json.RawMessage{
+		"remote": json.RawMessage(`{"redact":{"rules":[{"keys":["UserID"],"action":"hash"}]}}`),
+	}}
+
+	_, err := CreateLogManagerWithConfig(factories, config)
+	require.ErrorIs(t, err, ErrorAllDriversFailed)
+	// Never left running unredacted
+	require.True(t, drv.stopped)
+}
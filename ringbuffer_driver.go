@@ -0,0 +1,362 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const RingBufferDriverID = "ringbuffer"
+
+const (
+	defaultRingBufferSize  = 1000
+	defaultRingBufferMaxTx = 100
+)
+
+// Param added to the marker record written before each dump
+const DumpTriggerParam Param = "dumpTrigger"
+
+const (
+	ErrorDumpTrigger  = "error"
+	SignalDumpTrigger = "signal"
+	APIDumpTrigger    = "api"
+)
+
+type ringBufferConfig struct {
+	Size         int                          `json:"size"`         // records kept, per transaction with perTx; default 1000
+	PerTx        bool                         `json:"perTx"`        // keep a history per transaction, dropped when the transaction ends
+	MaxTx        int                          `json:"maxTx"`        // transaction histories kept, newer ones use the shared history; default 100
+	DumpOnError  bool                         `json:"dumpOnError"`  // dump when an Error record is logged
+	DumpOnSignal bool                         `json:"dumpOnSignal"` // dump on SIGUSR1
+	DumpFile     string                       `json:"dumpFile"`     // file the dumps are appended to
+	DumpFormat   string                       `json:"dumpFormat"`   // "text" (default) or "json"; dumpFile only
+	DumpDriver   map[DriverID]json.RawMessage `json:"dumpDriver"`   // driver config receiving the dumped records
+}
+
+// RingBufferDriverFactory implements DriverFactoryInterface
+type RingBufferDriverFactory struct {
+	factories []DriverFactoryInterface
+}
+
+// NewRingBufferDriverFactory takes the factories available for the dumpDriver config
+func NewRingBufferDriverFactory(factories ...DriverFactoryInterface) *RingBufferDriverFactory {
+	return &RingBufferDriverFactory{
+		factories: factories,
+	}
+}
+
+func (f *RingBufferDriverFactory) DriverID() DriverID {
+	return DriverID(RingBufferDriverID)
+}
+
+func (f *RingBufferDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var ringConfig ringBufferConfig
+	err := json.Unmarshal(config, &ringConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ringbuffer driver config: %w", err)
+	}
+
+	if ringConfig.Size <= 0 {
+		ringConfig.Size = defaultRingBufferSize
+	}
+	if ringConfig.MaxTx <= 0 {
+		ringConfig.MaxTx = defaultRingBufferMaxTx
+	}
+	if ringConfig.DumpOnSignal && len(dumpSignals) == 0 {
+		return nil, fmt.Errorf("ringbuffer dump on signal is not supported on this platform")
+	}
+
+	var target DriverInterface
+	if len(ringConfig.DumpDriver) > 0 {
+		target, err = f.createDumpDriver(ringConfig.DumpDriver)
+		if err != nil {
+			return nil, err
+		}
+	} else if ringConfig.DumpFile == "" {
+		target = &ConsoleDriver{}
+	}
+
+	d := NewRingBufferDriver(ringConfig.Size, target)
+	d.perTx = ringConfig.PerTx
+	d.maxTx = ringConfig.MaxTx
+	d.dumpOnError = ringConfig.DumpOnError
+	d.dumpFile = ringConfig.DumpFile
+	d.dumpFormat = ringConfig.DumpFormat
+	if ringConfig.DumpOnSignal {
+		d.notifySignals()
+	}
+	return d, nil
+}
+
+func (f *RingBufferDriverFactory) createDumpDriver(config map[DriverID]json.RawMessage) (DriverInterface, error) {
+	if len(config) != 1 {
+		return nil, fmt.Errorf("ringbuffer dumpDriver must configure exactly one driver")
+	}
+	for _, factory := range f.factories {
+		if driverConfig, ok := config[factory.DriverID()]; ok {
+			driver, err := factory.CreateDriver(driverConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create ringbuffer dump driver %s: %w", factory.DriverID(), err)
+			}
+			return driver, nil
+		}
+	}
+	for id := range config {
+		return nil, fmt.Errorf("unknown ringbuffer dump driver: %s", id)
+	}
+	return nil, nil
+}
+
+// recordRing keeps the last records added
+type recordRing struct {
+	records []map[Param]string
+	next    int
+}
+
+func newRecordRing(size int) *recordRing {
+	return &recordRing{
+		records: make([]map[Param]string, 0, size),
+	}
+}
+
+func (r *recordRing) add(data map[Param]string) {
+	if len(r.records) < cap(r.records) {
+		r.records = append(r.records, data)
+		return
+	}
+	r.records[r.next] = data
+	r.next = (r.next + 1) % len(r.records)
+}
+
+// drain returns the records oldest first and empties the ring
+func (r *recordRing) drain() []map[Param]string {
+	records := append(r.records[r.next:], r.records[:r.next]...)
+	r.records = make([]map[Param]string, 0, cap(r.records))
+	r.next = 0
+	return records
+}
+
+// RingBufferDriver implements DriverInterface
+// It keeps the last records of all levels in memory and writes them out when triggered, so that
+// the Debug context of an incident is available even when the other drivers filter it out.
+// Dumped records are removed from the history
+type RingBufferDriver struct {
+	errorReporter
+
+	size        int
+	perTx       bool
+	maxTx       int
+	dumpOnError bool
+	dumpFile    string
+	dumpFormat  string
+	target      DriverInterface
+
+	mutex   sync.Mutex
+	shared  *recordRing
+	txRings map[string]*recordRing
+
+	// serializes the dumps of the logging goroutines and the signal handler
+	dumpMutex sync.Mutex
+
+	signals chan os.Signal
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewRingBufferDriver keeps the last size records and dumps them to target; use the factory
+// config for the per transaction history, the dump triggers and the dump file
+func NewRingBufferDriver(size int, target DriverInterface) *RingBufferDriver {
+	return &RingBufferDriver{
+		size:    size,
+		maxTx:   defaultRingBufferMaxTx,
+		target:  target,
+		shared:  newRecordRing(size),
+		txRings: make(map[string]*recordRing),
+	}
+}
+
+func (d *RingBufferDriver) Log(data map[Param]string) {
+	txID := data[TxIDParam]
+
+	d.mutex.Lock()
+	ring := d.shared
+	if txRing, ok := d.txRings[txID]; ok {
+		ring = txRing
+	}
+	ring.add(data)
+	var records []map[Param]string
+	if d.dumpOnError && LogLevel(data[LevelParam]) == Error {
+		records = ring.drain()
+	}
+	d.mutex.Unlock()
+
+	if records != nil {
+		d.dump(ErrorDumpTrigger, txID, records)
+	}
+}
+
+func (d *RingBufferDriver) BeginTx(id TxID, attr map[Param]string) {
+	if d.perTx {
+		d.mutex.Lock()
+		if len(d.txRings) < d.maxTx {
+			d.txRings[id.String()] = newRecordRing(d.size)
+		}
+		d.mutex.Unlock()
+	}
+
+	txData := make(map[Param]string)
+	for k, v := range attr {
+		txData[k] = v
+	}
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX Begin"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *RingBufferDriver) EndTx(id TxID) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+	d.dropTxRing(id)
+}
+
+func (d *RingBufferDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+	d.dropTxRing(id)
+}
+
+func (d *RingBufferDriver) dropTxRing(id TxID) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.txRings, id.String())
+}
+
+// Dump writes out the whole history: the shared records, then each transaction
+func (d *RingBufferDriver) Dump() {
+	d.dumpAll(APIDumpTrigger)
+}
+
+// SetErrorHandler receives the errors of the dump file and of the dump driver
+func (d *RingBufferDriver) SetErrorHandler(handler func(err error)) {
+	d.errorReporter.SetErrorHandler(handler)
+	if d.target != nil {
+		setErrorHandler(d.target, handler)
+	}
+}
+
+func (d *RingBufferDriver) dumpAll(trigger string) {
+	d.mutex.Lock()
+	txIDs := make([]string, 0, len(d.txRings))
+	for txID := range d.txRings {
+		txIDs = append(txIDs, txID)
+	}
+	sort.Slice(txIDs, func(i, j int) bool {
+		a, _ := strconv.ParseInt(txIDs[i], 10, 64)
+		b, _ := strconv.ParseInt(txIDs[j], 10, 64)
+		return a < b
+	})
+	shared := d.shared.drain()
+	txRecords := make([][]map[Param]string, len(txIDs))
+	for i, txID := range txIDs {
+		txRecords[i] = d.txRings[txID].drain()
+	}
+	d.mutex.Unlock()
+
+	d.dump(trigger, "", shared)
+	for i, txID := range txIDs {
+		d.dump(trigger, txID, txRecords[i])
+	}
+}
+
+func (d *RingBufferDriver) dump(trigger string, txID string, records []map[Param]string) {
+	if len(records) == 0 {
+		return
+	}
+
+	marker := map[Param]string{
+		MessageParam:     fmt.Sprintf("Ring buffer dump: %d records", len(records)),
+		LevelParam:       string(Info),
+		DumpTriggerParam: trigger,
+	}
+	if txID != "" {
+		marker[TxIDParam] = txID
+	}
+	records = append([]map[Param]string{marker}, records...)
+
+	d.dumpMutex.Lock()
+	defer d.dumpMutex.Unlock()
+
+	if d.target != nil {
+		for _, record := range records {
+			d.target.Log(record)
+		}
+		flushDriver(d.target)
+	}
+	if d.dumpFile != "" {
+		err := d.writeDumpFile(records)
+		if err != nil {
+			d.reportError(fmt.Errorf("failed to write ring buffer dump to %s: %w", d.dumpFile, err))
+		}
+	}
+}
+
+func (d *RingBufferDriver) writeDumpFile(records []map[Param]string) error {
+	file, err := openFile(d.dumpFile)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		_, err = file.WriteString(formatRecord(record, d.dumpFormat, false) + "\n")
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+func (d *RingBufferDriver) notifySignals() {
+	d.signals = make(chan os.Signal, 1)
+	d.done = make(chan struct{})
+	signal.Notify(d.signals, dumpSignals...)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			select {
+			case <-d.signals:
+				d.dumpAll(SignalDumpTrigger)
+			case <-d.done:
+				return
+			}
+		}
+	}()
+}
+
+func (d *RingBufferDriver) Stop() {
+	if d.signals != nil {
+		signal.Stop(d.signals)
+		close(d.done)
+		d.wg.Wait()
+		d.signals = nil
+	}
+	if d.target != nil {
+		d.target.Stop()
+	}
+}
@@ -0,0 +1,166 @@
+package logsystem
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func messages(records []map[Param]string) []string {
+	var result []string
+	for _, record := range records {
+		result = append(result, record[MessageParam])
+	}
+	return result
+}
+
+func TestRingBufferDriver_DumpOnError(t *testing.T) {
+	target := &RecordingDriver{}
+	drv, err := NewRingBufferDriverFactory(&RecordingDriverFactory{id: "recording", driver: target}).
+		CreateDriver(json.RawMessage(`{"size":3,"dumpOnError":true,"dumpDriver":{"recording":{}}}`))
+	require.NoError(t, err)
+
+	for _, message := range []string{"one", "two", "three", "four"} {
+		drv.Log(map[Param]string{MessageParam: message, LevelParam: string(Debug)})
+	}
+	require.Empty(t, target.Records())
+
+	drv.Log(map[Param]string{MessageParam: "failed", LevelParam: string(Error)})
+	records := target.Records()
+	require.Equal(t, []string{"Ring buffer dump: 3 records", "three", "four", "failed"}, messages(records))
+	require.Equal(t, ErrorDumpTrigger, records[0][DumpTriggerParam])
+	require.Equal(t, 1, target.flushes)
+
+	// The dumped records are gone from the history
+	drv.(*RingBufferDriver).Dump()
+	require.Len(t, target.Records(), 4)
+
+	drv.Stop()
+	require.True(t, target.stopped)
+}
+
+func TestRingBufferDriver_PerTx(t *testing.T) {
+	target := &RecordingDriver{}
+	drv := NewRingBufferDriver(10, target)
+	drv.perTx = true
+	drv.dumpOnError = true
+
+	drv.Log(map[Param]string{MessageParam: "shared"})
+	drv.BeginTx(1, map[Param]string{"UserID": "1"})
+	drv.BeginTx(2, nil)
+	drv.Log(map[Param]string{MessageParam: "in 1", TxIDParam: "1"})
+	drv.Log(map[Param]string{MessageParam: "in 2", TxIDParam: "2"})
+	drv.Log(map[Param]string{MessageParam: "failed in 1", TxIDParam: "1", LevelParam: string(Error)})
+
+	records := target.Records()
+	require.Equal(t, []string{"Ring buffer dump: 3 records", "TX Begin", "in 1", "failed in 1"}, messages(records))
+	require.Equal(t, "1", records[0][TxIDParam])
+	require.Equal(t, "1", records[1]["UserID"])
+
+	// A failed transaction triggers a dump too
+	drv.BeginTx(3, nil)
+	drv.EndTxWithStatus(3, TxFailed)
+	require.Equal(t, []string{"Ring buffer dump: 2 records", "TX Begin", "TX End; Status: failed"}, messages(target.Records()[4:]))
+
+	// Ended transactions don't keep a history
+	drv.EndTx(2)
+	drv.Log(map[Param]string{MessageParam: "after", TxIDParam: "1"})
+	drv.Dump()
+	records = target.Records()[7:]
+	require.Equal(t, []string{"Ring buffer dump: 1 records", "shared", "Ring buffer dump: 1 records", "after"}, messages(records))
+	require.Equal(t, APIDumpTrigger, records[0][DumpTriggerParam])
+	require.Equal(t, "1", records[2][TxIDParam])
+}
+
+func TestRingBufferDriver_MaxTx(t *testing.T) {
+	target := &RecordingDriver{}
+	drv := NewRingBufferDriver(10, target)
+	drv.perTx = true
+	drv.maxTx = 1
+
+	drv.BeginTx(1, nil)
+	drv.BeginTx(2, nil)
+	drv.Log(map[Param]string{MessageParam: "in 2", TxIDParam: "2"})
+	drv.Dump()
+	// Transaction 2 exceeded maxTx and uses the shared history
+	require.Equal(t, []string{"Ring buffer dump: 2 records", "TX Begin", "in 2", "Ring buffer dump: 1 records", "TX Begin"}, messages(target.Records()))
+}
+
+func TestRingBufferDriver_DumpFileOnSignal(t *testing.T) {
+	if len(dumpSignals) == 0 {
+		t.Skip("no dump signal on this platform")
+	}
+	path := filepath.Join(t.TempDir(), "dump.log")
+	drv, err := NewRingBufferDriverFactory().CreateDriver(json.RawMessage(`{"dumpOnSignal":true,"dumpFile":"` + path + `","dumpFormat":"json"}`))
+	require.NoError(t, err)
+	defer drv.Stop()
+
+	drv.Log(map[Param]string{MessageParam: "debug context", LevelParam: string(Debug)})
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, process.Signal(dumpSignals[0]))
+
+	var lines []map[string]any
+	require.Eventually(t, func() bool {
+		file, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		defer file.Close()
+		lines = nil
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var line map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+		return len(lines) == 2
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, SignalDumpTrigger, lines[0][string(DumpTriggerParam)])
+	require.Equal(t, "debug context", lines[1]["message"])
+}
+
+func TestRingBufferDriver_DumpFileKeepsRecordTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.log")
+	drv, err := NewRingBufferDriverFactory().CreateDriver(json.RawMessage(`{"dumpFile":"` + path + `"}`))
+	require.NoError(t, err)
+	defer drv.Stop()
+
+	drv.Log(map[Param]string{MessageParam: "debug context", LevelParam: string(Debug), TimeParam: "1000"})
+	drv.(*RingBufferDriver).Dump()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, "[1000      ] DEBUG debug context", lines[1])
+}
+
+func TestLogger_Dump(t *testing.T) {
+	target := &RecordingDriver{}
+	m := NewManager()
+	m.AddDriver(NewSerialDriver(NewRingBufferDriver(10, target)))
+	logger := NewLogger(m)
+
+	logger.Debug("before the incident")
+	logger.Dump()
+	require.Equal(t, []string{"Ring buffer dump: 1 records", "before the incident"}, messages(target.Records()))
+}
+
+func TestRingBufferDriverFactory_InvalidConfig(t *testing.T) {
+	factory := NewRingBufferDriverFactory(&ConsoleDriverFactory{})
+	for _, config := range []string{
+		`{"dumpDriver":{"unknown":{}}}`,
+		`{"dumpDriver":{"console":{},"file":{}}}`,
+		`{"size":"big"}`,
+	} {
+		_, err := factory.CreateDriver(json.RawMessage(config))
+		require.Error(t, err, config)
+	}
+}
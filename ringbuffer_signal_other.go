@@ -0,0 +1,8 @@
+//go:build !unix
+
+package logsystem
+
+import "os"
+
+// There is no SIGUSR1; ring buffer dumps are triggered by errors or the API only
+var dumpSignals []os.Signal
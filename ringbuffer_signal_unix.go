@@ -0,0 +1,11 @@
+//go:build unix
+
+package logsystem
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals triggering a ring buffer dump
+var dumpSignals = []os.Signal{syscall.SIGUSR1}
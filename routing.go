@@ -0,0 +1,219 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RecordFilter selects records. A record matches when all the set conditions match; a filter
+// without conditions matches every record
+type RecordFilter struct {
+	Levels     []LogLevel       `json:"levels"`     // any of the levels
+	Components []string         `json:"components"` // any of the components
+	TxAttr     map[Param]string `json:"txAttr"`     // attributes of the record's transaction, all equal
+	Message    string           `json:"message"`    // regular expression matched against the message
+}
+
+// RouteRule sends the records it matches to its drivers only
+type RouteRule struct {
+	RecordFilter
+	Drivers []DriverID `json:"drivers"` // receivers of the matching records
+}
+
+type recordMatcher struct {
+	filter     RecordFilter
+	levels     map[LogLevel]bool
+	components map[string]bool
+	message    *regexp.Regexp
+}
+
+func newRecordMatcher(filter RecordFilter) (*recordMatcher, error) {
+	m := &recordMatcher{filter: filter}
+	if len(filter.Levels) > 0 {
+		m.levels = make(map[LogLevel]bool, len(filter.Levels))
+		for _, level := range filter.Levels {
+			m.levels[level] = true
+		}
+	}
+	if len(filter.Components) > 0 {
+		m.components = make(map[string]bool, len(filter.Components))
+		for _, component := range filter.Components {
+			m.components[component] = true
+		}
+	}
+	if filter.Message != "" {
+		message, err := regexp.Compile(filter.Message)
+		if err != nil {
+			return nil, err
+		}
+		m.message = message
+	}
+	return m, nil
+}
+
+func (m *recordMatcher) matches(data map[Param]string, txAttr map[Param]string) bool {
+	if m.levels != nil && !m.levels[LogLevel(data[LevelParam])] {
+		return false
+	}
+	if m.components != nil && !m.components[data[ComponentParam]] {
+		return false
+	}
+	for k, v := range m.filter.TxAttr {
+		if value, ok := txAttr[k]; !ok || value != v {
+			return false
+		}
+	}
+	if m.message != nil && !m.message.MatchString(data[MessageParam]) {
+		return false
+	}
+	return true
+}
+
+func (m *recordMatcher) String() string {
+	var conditions []string
+	if len(m.filter.Levels) > 0 {
+		levels := make([]string, len(m.filter.Levels))
+		for i, level := range m.filter.Levels {
+			levels[i] = string(level)
+		}
+		conditions = append(conditions, "level in ["+strings.Join(levels, ", ")+"]")
+	}
+	if len(m.filter.Components) > 0 {
+		conditions = append(conditions, "component in ["+strings.Join(m.filter.Components, ", ")+"]")
+	}
+	keys := make([]string, 0, len(m.filter.TxAttr))
+	for k := range m.filter.TxAttr {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		conditions = append(conditions, fmt.Sprintf("tx %s=%s", k, m.filter.TxAttr[Param(k)]))
+	}
+	if m.message != nil {
+		conditions = append(conditions, fmt.Sprintf("message =~ /%s/", m.filter.Message))
+	}
+	if len(conditions) == 0 {
+		return "any record"
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// router picks the drivers of a record from the first matching rule; records matching no rule
+// go to all drivers
+type router struct {
+	rules        []compiledRoute
+	needsTxAttrs bool
+}
+
+type compiledRoute struct {
+	*recordMatcher
+	drivers []DriverID
+	targets []int // indexes of the drivers in the manager
+}
+
+func newRouter(rules []RouteRule, ids []DriverID) (*router, error) {
+	indexes := make(map[DriverID][]int)
+	for i, id := range ids {
+		indexes[id] = append(indexes[id], i)
+	}
+
+	r := &router{}
+	for i, rule := range rules {
+		matcher, err := newRecordMatcher(rule.RecordFilter)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		route := compiledRoute{recordMatcher: matcher, drivers: rule.Drivers}
+		// Configured drivers that failed to initialize have no index; their records are dropped
+		for _, id := range rule.Drivers {
+			route.targets = append(route.targets, indexes[id]...)
+		}
+		if len(rule.TxAttr) > 0 {
+			r.needsTxAttrs = true
+		}
+		r.rules = append(r.rules, route)
+	}
+	return r, nil
+}
+
+// validateRoutes checks the rules without creating the drivers; it rejects the rules naming
+// drivers missing from the config, whose records would be dropped
+func validateRoutes(rules []RouteRule, drivers map[DriverID]json.RawMessage) error {
+	_, err := newRouter(rules, nil)
+	if err != nil {
+		return err
+	}
+	for i, rule := range rules {
+		var unknown []DriverID
+		for _, id := range rule.Drivers {
+			if _, ok := drivers[id]; !ok {
+				unknown = append(unknown, id)
+			}
+		}
+		if len(unknown) > 0 {
+			return fmt.Errorf("route %d: drivers not configured: %s", i, joinDriverIDs(unknown))
+		}
+	}
+	return nil
+}
+
+// routedDrivers returns the drivers named by the rules
+func routedDrivers(rules []RouteRule) map[DriverID]bool {
+	routed := make(map[DriverID]bool)
+	for _, rule := range rules {
+		for _, id := range rule.Drivers {
+			routed[id] = true
+		}
+	}
+	return routed
+}
+
+// route returns the indexes of the drivers receiving the record; all is true when no rule matches
+func (r *router) route(data map[Param]string, txAttr map[Param]string) (targets []int, all bool) {
+	for _, route := range r.rules {
+		if route.matches(data, txAttr) {
+			return route.targets, false
+		}
+	}
+	return nil, true
+}
+
+// DescribeRoutes validates the routing rules of the config and explains them, one line per
+// rule in evaluation order, without creating any driver
+func DescribeRoutes(config Config) (string, error) {
+	ids := make([]DriverID, 0, len(config.Drivers))
+	for id := range config.Drivers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	err := validateRoutes(config.Routes, config.Drivers)
+	if err != nil {
+		return "", err
+	}
+	r, err := newRouter(config.Routes, ids)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i, route := range r.rules {
+		fmt.Fprintf(&sb, "%d. %s -> %s\n", i+1, route.String(), joinDriverIDs(route.drivers))
+	}
+	fmt.Fprintf(&sb, "otherwise -> %s\n", joinDriverIDs(ids))
+	return sb.String(), nil
+}
+
+func joinDriverIDs(ids []DriverID) string {
+	if len(ids) == 0 {
+		return "none"
+	}
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = string(id)
+	}
+	return strings.Join(names, ", ")
+}
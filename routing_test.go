@@ -0,0 +1,140 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newRoutedManager(t *testing.T, routes string) (*DriverManager, map[DriverID]*RecordingDriver) {
+	drivers := map[DriverID]*RecordingDriver{
+		"console": {},
+		"file":    {},
+		"sqlite":  {},
+	}
+	config := Config{Drivers: map[DriverID]json.RawMessage{}}
+	var factories []DriverFactoryInterface
+	for _, id := range []DriverID{"console", "file", "sqlite"} {
+		factories = append(factories, &RecordingDriverFactory{id: id, driver: drivers[id]})
+		config.Drivers[id] = json.RawMessage(`{}`)
+	}
+	require.NoError(t, json.Unmarshal([]byte(routes), &config.Routes))
+
+	mgr, err := CreateLogManagerWithConfig(factories, config)
+	require.NoError(t, err)
+	return mgr, drivers
+}
+
+func TestDriverManager_Routes(t *testing.T) {
+	mgr, drivers := newRoutedManager(t, `[
+		{"components":["payments"],"drivers":["sqlite","file"]},
+		{"levels":["debug"],"drivers":["console"]},
+		{"message":"^audit:","drivers":["file"]}
+	]`)
+	l := NewLogger(mgr)
+
+	tx := l.BeginTxWithComponent("payments", nil)
+	tx.Debug("charged")
+	tx.EndTx()
+	l.Debug("cache miss")
+	l.Info("audit: user created")
+	l.Info("started")
+
+	require.Equal(t, []string{"cache miss", "started"}, messages(drivers["console"].Records()))
+	require.Equal(t, []string{"charged", "audit: user created", "started"}, messages(drivers["file"].Records()))
+	require.Equal(t, []string{"charged", "started"}, messages(drivers["sqlite"].Records()))
+	// Transaction events reach every driver
+	for _, drv := range drivers {
+		require.Len(t, drv.begins, 1)
+		require.Len(t, drv.ends, 1)
+	}
+}
+
+func TestDriverManager_RoutesByTxAttr(t *testing.T) {
+	mgr, drivers := newRoutedManager(t, `[{"txAttr":{"tenant":"acme"},"drivers":["sqlite"]}]`)
+	l := NewLogger(mgr)
+
+	acme := l.BeginTx(map[Param]string{"tenant": "acme"})
+	other := l.BeginTx(map[Param]string{"tenant": "globex"})
+	acme.Info("acme")
+	other.Info("globex")
+	acme.EndTxWithStatus(TxSucceeded)
+	other.EndTx()
+
+	require.Equal(t, []string{"globex"}, messages(drivers["console"].Records()))
+	require.Equal(t, []string{"acme", "globex"}, messages(drivers["sqlite"].Records()))
+	require.Empty(t, mgr.txAttrs)
+}
+
+func TestCreateLogManagerWithConfig_RoutesToUnknownDriver(t *testing.T) {
+	drv := &RecordingDriver{}
+	config := Config{
+		Drivers: map[DriverID]json.RawMessage{"console": json.RawMessage(`{}`)},
+		Routes:  []RouteRule{{RecordFilter: RecordFilter{Levels: []LogLevel{Error}}, Drivers: []DriverID{"console", "pagerduty"}}},
+	}
+
+	mgr, err := CreateLogManagerWithConfig([]DriverFactoryInterface{&RecordingDriverFactory{id: "console", driver: drv}}, config)
+	require.EqualError(t, err, "invalid routes: route 0: drivers not configured: pagerduty")
+	require.Nil(t, mgr)
+}
+
+func TestDriverManager_RoutesToFailedDriver(t *testing.T) {
+	drv := &RecordingDriver{}
+	config := Config{
+		Drivers: map[DriverID]json.RawMessage{"console": json.RawMessage(`{}`), "failing": json.RawMessage(`{}`)},
+		Routes:  []RouteRule{{RecordFilter: RecordFilter{Levels: []LogLevel{Error}}, Drivers: []DriverID{"failing"}}},
+	}
+
+	mgr, err := CreateLogManagerWithConfig([]DriverFactoryInterface{&RecordingDriverFactory{id: "console", driver: drv}, &FailingDriverFactory{}}, config)
+	require.ErrorIs(t, err, ErrorSomeDriversFailed)
+	NewLogger(mgr).Error("lost")
+	NewLogger(mgr).Info("kept")
+
+	records := drv.Records()
+	require.Equal(t, []string{"Driver failing failed to start; the records routed to it are dropped", "kept"}, messages(records))
+	require.Equal(t, "failing", records[0]["driver_id"])
+}
+
+func TestCreateLogManagerWithConfig_InvalidRoutes(t *testing.T) {
+	drv := &RecordingDriver{}
+	config := Config{
+		Drivers: map[DriverID]json.RawMessage{"console": json.RawMessage(`{}`)},
+		Routes:  []RouteRule{{RecordFilter: RecordFilter{Message: "("}, Drivers: []DriverID{"console"}}},
+	}
+
+	mgr, err := CreateLogManagerWithConfig([]DriverFactoryInterface{&RecordingDriverFactory{id: "console", driver: drv}}, config)
+	require.Error(t, err)
+	require.Nil(t, mgr)
+	// Rejected before the drivers are created
+	require.False(t, drv.stopped)
+}
+
+func TestDescribeRoutes(t *testing.T) {
+	config, err := loadConfig([]byte(`{
+		"drivers": {"console": {}, "file": {}, "sqlite": {}},
+		"routes": [
+			{"components":["payments"],"txAttr":{"tenant":"acme","region":"eu"},"drivers":["sqlite","file"]},
+			{"levels":["debug","info"],"message":"^cache","drivers":["console"]},
+			{"drivers":[]}
+		]
+	}`))
+	require.NoError(t, err)
+
+	description, err := DescribeRoutes(config)
+	require.NoError(t, err)
+	require.Equal(t, `1. component in [payments] and tx region=eu and tx tenant=acme -> sqlite, file
+2. level in [debug, info] and message =~ /^cache/ -> console
+3. any record -> none
+otherwise -> console, file, sqlite
+`, description)
+
+	config.Routes[1].Message = "["
+	_, err = DescribeRoutes(config)
+	require.Error(t, err)
+
+	config.Routes[1].Message = ""
+	config.Routes[0].Drivers = []DriverID{"sqlite", "audit"}
+	_, err = DescribeRoutes(config)
+	require.EqualError(t, err, "route 0: drivers not configured: audit")
+}
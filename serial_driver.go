@@ -66,6 +66,41 @@ func (d *SerialDriver) EndTx(id TxID) {
 	d.provider.EndTx(id)
 }
 
+func (d *SerialDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	endTxWithStatus(d.provider, id, status)
+}
+
+func (d *SerialDriver) Flush() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	flushDriver(d.provider)
+}
+
+func (d *SerialDriver) Dump() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	dumpDriver(d.provider)
+}
+
+func (d *SerialDriver) SetErrorHandler(handler func(err error)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	setErrorHandler(d.provider, handler)
+}
+
+func (d *SerialDriver) Health() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return driverHealth(d.provider)
+}
+
+// ReportsErrorsAsync is the one of the wrapped driver
+func (d *SerialDriver) ReportsErrorsAsync() bool {
+	return reportsErrorsAsync(d.provider)
+}
+
 func (d *SerialDriver) Stop() {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
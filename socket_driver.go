@@ -0,0 +1,359 @@
+package logsystem
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const SocketDriverID = "socket"
+
+// LengthPrefixedFormat frames each JSON record with its length as a 4 bytes big endian integer
+const LengthPrefixedFormat = "lengthPrefixed"
+
+const (
+	defaultSocketMaxBuffered         = 1000
+	defaultSocketReconnectBackoff    = 100 * time.Millisecond
+	defaultSocketMaxReconnectBackoff = 30 * time.Second
+	defaultSocketWriteTimeout        = 5 * time.Second
+	socketDialTimeout                = 5 * time.Second
+)
+
+type socketConfig struct {
+	Network               string `json:"network"`               // tcp (default), udp, unix or unixgram
+	Address               string `json:"address"`               // host:port or socket path
+	Format                string `json:"format"`                // "text" (default), "json", "lengthPrefixed" or "binary"
+	UserReadableTime      bool   `json:"userReadableTime"`      // text format only
+	MaxBuffered           int    `json:"maxBuffered"`           // records kept while disconnected, the oldest are dropped; default 1000
+	ReconnectBackoffMs    int    `json:"reconnectBackoffMs"`    // initial reconnect delay, doubled after each failure; default 100
+	MaxReconnectBackoffMs int    `json:"maxReconnectBackoffMs"` // default 30000
+	WriteTimeoutMs        int    `json:"writeTimeoutMs"`        // a write not done in time is a disconnect; default 5000
+}
+
+// SocketDriverFactory implements DriverFactoryInterface
+type SocketDriverFactory struct {
+}
+
+func (f *SocketDriverFactory) DriverID() DriverID {
+	return DriverID(SocketDriverID)
+}
+
+func (f *SocketDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var socketConfig socketConfig
+	err := json.Unmarshal(config, &socketConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal socket driver config: %w", err)
+	}
+
+	if socketConfig.Network == "" {
+		socketConfig.Network = "tcp"
+	}
+	switch socketConfig.Network {
+	case "tcp", "udp", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("unknown socket network: %s", socketConfig.Network)
+	}
+	if socketConfig.Address == "" {
+		return nil, fmt.Errorf("socket address is required")
+	}
+	switch socketConfig.Format {
+	case "":
+		socketConfig.Format = TextFormat
+	case TextFormat, JSONFormat, LengthPrefixedFormat, BinaryFormat:
+	default:
+		return nil, fmt.Errorf("unknown socket format: %s", socketConfig.Format)
+	}
+	if socketConfig.MaxBuffered <= 0 {
+		socketConfig.MaxBuffered = defaultSocketMaxBuffered
+	}
+
+	return newSocketDriver(socketConfig), nil
+}
+
+// SocketState describes the connection of a SocketDriver
+type SocketState struct {
+	Connected bool
+	LastError error // the last dial or write error; nil once reconnected
+	Buffered  int   // records waiting to be sent
+	Dropped   int   // records dropped because the buffer was full
+}
+
+// SocketDriver implements DriverInterface
+// It streams the formatted records to a socket from a background goroutine. While the
+// connection is down the records are buffered and the driver reconnects with backoff. A peer not
+// reading the records within the write timeout counts as disconnected
+type SocketDriver struct {
+	errorReporter
+
+	config       socketConfig
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	writeTimeout time.Duration
+
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	queue    [][]byte
+	sending  bool
+	state    SocketState
+	stopping bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// only used from the writer goroutine
+	conn net.Conn
+}
+
+func newSocketDriver(config socketConfig) *SocketDriver {
+	d := &SocketDriver{
+		config:       config,
+		minBackoff:   defaultSocketReconnectBackoff,
+		maxBackoff:   defaultSocketMaxReconnectBackoff,
+		writeTimeout: defaultSocketWriteTimeout,
+		done:         make(chan struct{}),
+	}
+	if config.ReconnectBackoffMs > 0 {
+		d.minBackoff = time.Duration(config.ReconnectBackoffMs) * time.Millisecond
+	}
+	if config.MaxReconnectBackoffMs > 0 {
+		d.maxBackoff = time.Duration(config.MaxReconnectBackoffMs) * time.Millisecond
+	}
+	if config.WriteTimeoutMs > 0 {
+		d.writeTimeout = time.Duration(config.WriteTimeoutMs) * time.Millisecond
+	}
+	d.cond = sync.NewCond(&d.mutex)
+
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+func (d *SocketDriver) Log(data map[Param]string) {
+	d.enqueue(d.encode(data))
+}
+
+func (d *SocketDriver) enqueue(frame []byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.stopping {
+		return
+	}
+	if len(d.queue) >= d.config.MaxBuffered {
+		d.queue = d.queue[1:]
+		d.state.Dropped++
+	}
+	d.queue = append(d.queue, frame)
+	d.cond.Broadcast()
+}
+
+func (d *SocketDriver) BeginTx(id TxID, attr map[Param]string) {
+	if d.config.Format == BinaryFormat {
+		d.enqueue(wireFrame(WireEvent{Type: WireTxBegin, TxID: id, Params: attr}))
+		return
+	}
+	txData := make(map[Param]string)
+	for k, v := range attr {
+		txData[k] = v
+	}
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX Begin"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *SocketDriver) EndTx(id TxID) {
+	if d.config.Format == BinaryFormat {
+		d.enqueue(wireFrame(WireEvent{Type: WireTxEnd, TxID: id}))
+		return
+	}
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.Log(txData)
+}
+
+func (d *SocketDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	if d.config.Format == BinaryFormat {
+		d.enqueue(wireFrame(WireEvent{Type: WireTxEnd, TxID: id, Params: map[Param]string{TxStatusParam: string(status)}}))
+		return
+	}
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.Log(txData)
+}
+
+// Flush waits until the buffered records are written; it returns early while disconnected
+func (d *SocketDriver) Flush() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for (len(d.queue) > 0 || d.sending) && d.state.LastError == nil && !d.stopping {
+		d.cond.Wait()
+	}
+}
+
+// Stop writes the buffered records if the socket is reachable and closes the connection
+func (d *SocketDriver) Stop() {
+	d.mutex.Lock()
+	if d.stopping {
+		d.mutex.Unlock()
+		return
+	}
+	d.stopping = true
+	d.cond.Broadcast()
+	d.mutex.Unlock()
+
+	close(d.done)
+	d.wg.Wait()
+	d.closeConn()
+}
+
+// State returns a snapshot of the connection state
+func (d *SocketDriver) State() SocketState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	state := d.state
+	state.Buffered = len(d.queue)
+	if d.sending {
+		state.Buffered++
+	}
+	return state
+}
+
+// Health returns the last error while disconnected
+func (d *SocketDriver) Health() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.state.LastError != nil {
+		return fmt.Errorf("disconnected from %s %s: %w", d.config.Network, d.config.Address, d.state.LastError)
+	}
+	return nil
+}
+
+// ReportsErrorsAsync is true: the records are written from a goroutine
+func (d *SocketDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+func (d *SocketDriver) encode(data map[Param]string) []byte {
+	switch d.config.Format {
+	case BinaryFormat:
+		return wireFrame(WireEvent{Type: WireRecord, Params: data})
+	case LengthPrefixedFormat:
+		record := formatJSON(data)
+		frame := binary.BigEndian.AppendUint32(nil, uint32(len(record)))
+		return append(frame, record...)
+	default:
+		frame := []byte(formatRecord(data, d.config.Format, d.config.UserReadableTime))
+		if d.isStream() {
+			frame = append(frame, '\n')
+		}
+		return frame
+	}
+}
+
+func (d *SocketDriver) isStream() bool {
+	return d.config.Network == "tcp" || d.config.Network == "unix"
+}
+
+func (d *SocketDriver) run() {
+	defer d.wg.Done()
+
+	backoff := d.minBackoff
+	for {
+		d.mutex.Lock()
+		for len(d.queue) == 0 && !d.stopping {
+			d.cond.Wait()
+		}
+		if len(d.queue) == 0 {
+			d.mutex.Unlock()
+			return
+		}
+		frame := d.queue[0]
+		d.queue = d.queue[1:]
+		d.sending = true
+		stopping := d.stopping
+		d.mutex.Unlock()
+
+		err := d.write(frame)
+
+		var reportErrs []error
+		d.mutex.Lock()
+		d.sending = false
+		if err == nil {
+			d.state.Connected = true
+			d.state.LastError = nil
+		} else {
+			if d.state.Connected || d.state.LastError == nil {
+				reportErrs = append(reportErrs, fmt.Errorf("socket: disconnected from %s %s: %w", d.config.Network, d.config.Address, err))
+			}
+			d.state.Connected = false
+			d.state.LastError = err
+			// Put the record back unless newer records filled the buffer meanwhile
+			if len(d.queue) < d.config.MaxBuffered {
+				d.queue = append([][]byte{frame}, d.queue...)
+			} else {
+				d.state.Dropped++
+			}
+		}
+		d.cond.Broadcast()
+		if err != nil && stopping {
+			reportErrs = append(reportErrs, fmt.Errorf("socket: dropped %d records on stop: %w", len(d.queue), err))
+			d.queue = nil
+		}
+		d.mutex.Unlock()
+
+		for _, reportErr := range reportErrs {
+			d.reportError(reportErr)
+		}
+
+		if err == nil {
+			backoff = d.minBackoff
+			continue
+		}
+		if stopping {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-d.done:
+			// Stopping; make a last attempt without waiting
+		}
+		backoff = min(2*backoff, d.maxBackoff)
+	}
+}
+
+func (d *SocketDriver) write(frame []byte) error {
+	if d.conn == nil {
+		conn, err := net.DialTimeout(d.config.Network, d.config.Address, socketDialTimeout)
+		if err != nil {
+			return err
+		}
+		d.conn = conn
+	}
+	// A partly written frame is written again whole on the next connection
+	err := d.conn.SetWriteDeadline(time.Now().Add(d.writeTimeout))
+	if err == nil {
+		_, err = d.conn.Write(frame)
+	}
+	if err != nil {
+		d.closeConn()
+	}
+	return err
+}
+
+func (d *SocketDriver) closeConn() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
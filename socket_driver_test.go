@@ -0,0 +1,203 @@
+package logsystem
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createSocketDriver(t *testing.T, config string) *SocketDriver {
+	drv, err := (&SocketDriverFactory{}).CreateDriver(json.RawMessage(config))
+	require.NoError(t, err)
+	t.Cleanup(drv.Stop)
+	return drv.(*SocketDriver)
+}
+
+func TestSocketDriver_TCPText(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createSocketDriver(t, `{"address":"`+listener.Addr().String()+`"}`)
+	drv.Log(map[Param]string{MessageParam: "first", LevelParam: string(Info), TimeParam: "10"})
+	drv.Log(map[Param]string{MessageParam: "second", LevelParam: string(Error), TimeParam: "11"})
+	drv.Flush()
+	require.True(t, drv.State().Connected)
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, formatLine(map[Param]string{MessageParam: "first", LevelParam: string(Info), TimeParam: "10"}, false)+"\n", line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Contains(t, line, "second")
+}
+
+func TestSocketDriver_UDPJSON(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createSocketDriver(t, `{"network":"udp","address":"`+listener.LocalAddr().String()+`","format":"json"}`)
+	drv.BeginTx(5, map[Param]string{"UserID": "1"})
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(readDatagram(t, listener)), &record))
+	require.Equal(t, "TX Begin", record["message"])
+	require.Equal(t, "5", record["txID"])
+	require.Equal(t, "1", record["UserID"])
+}
+
+func TestSocketDriver_UnixLengthPrefixed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collector.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createSocketDriver(t, `{"network":"unix","address":"`+path+`","format":"lengthPrefixed"}`)
+	drv.Log(map[Param]string{MessageParam: "hello\nworld"})
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	var length uint32
+	require.NoError(t, binary.Read(conn, binary.BigEndian, &length))
+	record := make([]byte, length)
+	_, err = io.ReadFull(conn, record)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"message":"hello\nworld"}`, string(record))
+}
+
+func TestSocketDriver_BuffersWhileDisconnected(t *testing.T) {
+	// Reserve an address with nothing listening on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	drv := createSocketDriver(t, `{"address":"`+address+`","maxBuffered":3,"reconnectBackoffMs":10,"maxReconnectBackoffMs":20}`)
+	for _, message := range []string{"one", "two", "three", "four"} {
+		drv.Log(map[Param]string{MessageParam: message})
+	}
+	require.Eventually(t, func() bool {
+		state := drv.State()
+		return state.LastError != nil && !state.Connected
+	}, time.Second, 5*time.Millisecond)
+	// Flush doesn't block while the collector is down
+	drv.Flush()
+	state := drv.State()
+	require.Equal(t, 3, state.Buffered)
+	require.Equal(t, 1, state.Dropped)
+	require.ErrorIs(t, drv.Health(), state.LastError)
+
+	listener, err = net.Listen("tcp", address)
+	require.NoError(t, err)
+	defer listener.Close()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	reader := bufio.NewReader(conn)
+	var messages []string
+	for i := 0; i < 3; i++ {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		fields := strings.Fields(line)
+		messages = append(messages, fields[len(fields)-1])
+	}
+	require.Equal(t, []string{"two", "three", "four"}, messages)
+	require.Eventually(t, func() bool {
+		state := drv.State()
+		return state.Connected && state.LastError == nil && state.Buffered == 0
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, drv.Health())
+}
+
+func TestSocketDriver_WriteTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv, err := (&SocketDriverFactory{}).CreateDriver(json.RawMessage(`{"address":"` + listener.Addr().String() + `","writeTimeoutMs":50}`))
+	require.NoError(t, err)
+	socket := drv.(*SocketDriver)
+	socket.SetErrorHandler(func(error) {})
+	payload := strings.Repeat("x", 1<<20)
+	for i := 0; i < 64; i++ {
+		drv.Log(map[Param]string{MessageParam: payload})
+	}
+	// Accepted but never read: the records fill the socket buffers
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool {
+		var netErr net.Error
+		err := socket.State().LastError
+		return errors.As(err, &netErr) && netErr.Timeout()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		drv.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked on a peer not reading")
+	}
+}
+
+func TestSocketDriverFactory_InvalidConfig(t *testing.T) {
+	for _, config := range []string{
+		`{"address":""}`,
+		`{"network":"ip","address":"x"}`,
+		`{"address":"x","format":"xml"}`,
+	} {
+		_, err := (&SocketDriverFactory{}).CreateDriver(json.RawMessage(config))
+		require.Error(t, err, config)
+	}
+}
+
+func TestSocketDriver_BinaryFormat(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createSocketDriver(t, `{"address":"`+listener.Addr().String()+`","format":"binary"}`)
+	drv.BeginTx(9, map[Param]string{"UserID": "1"})
+	drv.Log(map[Param]string{MessageParam: "inside", TxIDParam: "9"})
+	drv.EndTx(9)
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+
+	var events []WireEvent
+	for i := 0; i < 3; i++ {
+		event, err := ReadWireEvent(conn)
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+	require.Equal(t, []WireEvent{
+		{Type: WireTxBegin, TxID: 9, Params: map[Param]string{"UserID": "1"}},
+		{Type: WireRecord, Params: map[Param]string{MessageParam: "inside", TxIDParam: "9"}},
+		{Type: WireTxEnd, TxID: 9, Params: map[Param]string{}},
+	}, events)
+}
@@ -0,0 +1,451 @@
+package logsystem
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	AlwaysFsync   = "always"   // sync each record before Log returns
+	IntervalFsync = "interval" // sync periodically
+	NeverFsync    = "never"    // leave it to the OS
+)
+
+const (
+	spoolSegmentExt      = ".seg"
+	spoolCheckpointFile  = "checkpoint"
+	spoolFrameHeaderSize = 8 // payload length and CRC-32C, big endian
+	spoolCheckpointSize  = 20
+)
+
+var errSpoolFull = errors.New("spool is full")
+
+var spoolCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// spoolPosition is a read position: a segment and an offset in it
+type spoolPosition struct {
+	segment uint64
+	offset  int64
+}
+
+// spoolFrame is a payload read from the spool and the position following it
+type spoolFrame struct {
+	payload []byte
+	end     spoolPosition
+}
+
+// spool is a persistent queue of payloads. They are appended as frames (length, CRC-32C,
+// payload) to numbered segment files, a new segment being started when the current one is full.
+// The checkpoint file holds the position up to which the payloads were delivered; the segments
+// before it are deleted, the segment written when it's full and fully delivered. When opened, a
+// torn frame at the end of the last segment, left by a crash during a write, is truncated
+type spool struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64
+	fsync        string
+
+	mutex     sync.Mutex
+	sizes     map[uint64]int64 // sizes of the segments
+	file      *os.File         // segment written
+	segment   uint64
+	total     int64
+	unsynced  bool
+	committed spoolPosition // checkpointed read position
+}
+
+// openSpool recovers the spool in dir, creating it if needed, and returns the checkpointed read
+// position
+func openSpool(dir string, segmentBytes, maxBytes int64, fsync string) (*spool, spoolPosition, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, spoolPosition{}, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, spoolPosition{}, err
+	}
+
+	s := &spool{
+		dir:          dir,
+		segmentBytes: segmentBytes,
+		maxBytes:     maxBytes,
+		fsync:        fsync,
+		sizes:        make(map[uint64]int64),
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		segment, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+
+	checkpoint := s.readCheckpoint()
+	// Delivered segments left by a crash after the checkpoint
+	kept := segments[:0]
+	for _, segment := range segments {
+		if segment < checkpoint.segment {
+			os.Remove(s.segmentPath(segment))
+			continue
+		}
+		kept = append(kept, segment)
+	}
+	segments = kept
+
+	if len(segments) == 0 {
+		s.segment = max(checkpoint.segment, 1)
+		s.file, err = os.OpenFile(s.segmentPath(s.segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, spoolPosition{}, err
+		}
+		s.sizes[s.segment] = 0
+		s.committed = spoolPosition{segment: s.segment}
+		return s, s.committed, nil
+	}
+	if checkpoint.segment != segments[0] {
+		checkpoint = spoolPosition{segment: segments[0]}
+	}
+
+	for _, segment := range segments[:len(segments)-1] {
+		info, err := os.Stat(s.segmentPath(segment))
+		if err != nil {
+			return nil, spoolPosition{}, err
+		}
+		s.sizes[segment] = info.Size()
+		s.total += info.Size()
+	}
+
+	s.segment = segments[len(segments)-1]
+	end, err := s.recoverSegment(s.segment)
+	if err != nil {
+		return nil, spoolPosition{}, err
+	}
+	s.sizes[s.segment] = end
+	s.total += end
+	if checkpoint.segment == s.segment {
+		checkpoint.offset = min(checkpoint.offset, end)
+	}
+	s.committed = checkpoint
+	return s, checkpoint, nil
+}
+
+// recoverSegment truncates the segment after its last valid frame and opens it for appending
+func (s *spool) recoverSegment(segment uint64) (int64, error) {
+	path := s.segmentPath(segment)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var end int64
+	for {
+		payload, ok := decodeSpoolFrame(data[end:])
+		if !ok {
+			break
+		}
+		end += int64(spoolFrameHeaderSize + len(payload))
+	}
+
+	s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if end < int64(len(data)) {
+		err = s.file.Truncate(end)
+		if err == nil {
+			err = s.file.Sync()
+		}
+		if err != nil {
+			s.file.Close()
+			return 0, err
+		}
+	}
+	return end, nil
+}
+
+// decodeSpoolFrame returns the payload of the frame at the start of data; false if the frame is
+// incomplete or corrupt
+func decodeSpoolFrame(data []byte) ([]byte, bool) {
+	if len(data) < spoolFrameHeaderSize {
+		return nil, false
+	}
+	size := binary.BigEndian.Uint32(data)
+	if size > wireMaxFrameSize || int64(len(data)-spoolFrameHeaderSize) < int64(size) {
+		return nil, false
+	}
+	payload := data[spoolFrameHeaderSize : spoolFrameHeaderSize+int(size)]
+	if crc32.Checksum(payload, spoolCRCTable) != binary.BigEndian.Uint32(data[4:]) {
+		return nil, false
+	}
+	return payload, true
+}
+
+func (s *spool) segmentPath(segment uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", segment, spoolSegmentExt))
+}
+
+// append adds the payload at the end of the spool; it's durable once append returns with the
+// always fsync policy, once sync returns otherwise
+func (s *spool) append(payload []byte) error {
+	if len(payload) > wireMaxFrameSize {
+		return fmt.Errorf("spool: record of %d bytes exceeds the maximum size", len(payload))
+	}
+	frame := make([]byte, spoolFrameHeaderSize, spoolFrameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.Checksum(payload, spoolCRCTable))
+	frame = append(frame, payload...)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if s.total+int64(len(frame)) > s.maxBytes {
+		err := s.releaseDelivered()
+		if err != nil {
+			return err
+		}
+		if s.total+int64(len(frame)) > s.maxBytes {
+			return errSpoolFull
+		}
+	}
+	size := s.sizes[s.segment]
+	if size > 0 && size+int64(len(frame)) > s.segmentBytes {
+		err := s.rotate()
+		if err != nil {
+			return err
+		}
+		size = 0
+	}
+
+	n, err := s.file.Write(frame)
+	if err != nil {
+		if n > 0 {
+			// Don't leave a torn frame in front of the next ones
+			s.file.Truncate(size)
+		}
+		return err
+	}
+	s.sizes[s.segment] = size + int64(n)
+	s.total += int64(n)
+	if s.fsync == AlwaysFsync {
+		return s.file.Sync()
+	}
+	s.unsynced = true
+	return nil
+}
+
+// releaseDelivered deletes the segment written if it's fully delivered, starting the next one;
+// called under the mutex
+func (s *spool) releaseDelivered() error {
+	segment := s.segment
+	size := s.sizes[segment]
+	if size == 0 || s.committed.segment != segment || s.committed.offset < size {
+		return nil
+	}
+	err := s.rotate()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(s.segmentPath(segment))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(s.sizes, segment)
+	s.total -= size
+	return nil
+}
+
+// rotate closes the segment written and starts the next one
+func (s *spool) rotate() error {
+	err := s.file.Sync()
+	if err != nil {
+		return err
+	}
+	s.file.Close()
+	s.unsynced = false
+
+	file, err := os.OpenFile(s.segmentPath(s.segment+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		s.file = nil
+		return err
+	}
+	s.file = file
+	s.segment++
+	s.sizes[s.segment] = 0
+	return nil
+}
+
+// sync makes the appended payloads durable
+func (s *spool) sync() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil || !s.unsynced {
+		return nil
+	}
+	s.unsynced = false
+	return s.file.Sync()
+}
+
+// read returns up to n frames from pos and the position following them. A corrupt frame ends
+// its segment, or skips the frames of the last segment written before the read; it's returned as
+// an error with the frames read before it
+func (s *spool) read(pos spoolPosition, n int) ([]spoolFrame, spoolPosition, error) {
+	var frames []spoolFrame
+	for len(frames) < n {
+		s.mutex.Lock()
+		size, ok := s.sizes[pos.segment]
+		last := pos.segment == s.segment
+		s.mutex.Unlock()
+
+		if !ok || pos.offset >= size {
+			if last {
+				break
+			}
+			pos = spoolPosition{segment: pos.segment + 1}
+			continue
+		}
+
+		// Only the frames complete when the size was taken are read
+		read, next, err := s.readSegment(pos, size, n-len(frames))
+		frames = append(frames, read...)
+		if err != nil {
+			if last {
+				return frames, spoolPosition{segment: pos.segment, offset: size}, err
+			}
+			return frames, spoolPosition{segment: pos.segment + 1}, err
+		}
+		pos = next
+	}
+
+	// Past a fully read segment, so that committing the position releases it
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if size, ok := s.sizes[pos.segment]; ok && pos.offset >= size && pos.segment != s.segment {
+		pos = spoolPosition{segment: pos.segment + 1}
+	}
+	return frames, pos, nil
+}
+
+func (s *spool) readSegment(pos spoolPosition, size int64, n int) ([]spoolFrame, spoolPosition, error) {
+	file, err := os.Open(s.segmentPath(pos.segment))
+	if err != nil {
+		return nil, pos, err
+	}
+	defer file.Close()
+
+	data := make([]byte, size-pos.offset)
+	_, err = io.ReadFull(io.NewSectionReader(file, pos.offset, size-pos.offset), data)
+	if err != nil {
+		return nil, pos, err
+	}
+
+	var frames []spoolFrame
+	var offset int64
+	for offset < int64(len(data)) && len(frames) < n {
+		payload, ok := decodeSpoolFrame(data[offset:])
+		if !ok {
+			return frames, spoolPosition{segment: pos.segment, offset: pos.offset + offset},
+				fmt.Errorf("spool: corrupt frame in segment %d at offset %d", pos.segment, pos.offset+offset)
+		}
+		offset += int64(spoolFrameHeaderSize + len(payload))
+		frames = append(frames, spoolFrame{
+			payload: payload,
+			end:     spoolPosition{segment: pos.segment, offset: pos.offset + offset},
+		})
+	}
+	return frames, spoolPosition{segment: pos.segment, offset: pos.offset + offset}, nil
+}
+
+// commit checkpoints pos as delivered and deletes the segments before it
+func (s *spool) commit(pos spoolPosition) error {
+	var checkpoint [spoolCheckpointSize]byte
+	binary.BigEndian.PutUint64(checkpoint[:], pos.segment)
+	binary.BigEndian.PutUint64(checkpoint[8:], uint64(pos.offset))
+	binary.BigEndian.PutUint32(checkpoint[16:], crc32.Checksum(checkpoint[:16], spoolCRCTable))
+
+	path := filepath.Join(s.dir, spoolCheckpointFile)
+	err := writeFileSync(path+".tmp", checkpoint[:])
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.committed = pos
+	for segment, size := range s.sizes {
+		if segment >= pos.segment || segment == s.segment {
+			continue
+		}
+		err = os.Remove(s.segmentPath(segment))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(s.sizes, segment)
+		s.total -= size
+	}
+	return nil
+}
+
+// readCheckpoint returns the checkpointed position; the zero position if there is none
+func (s *spool) readCheckpoint() spoolPosition {
+	data, err := os.ReadFile(filepath.Join(s.dir, spoolCheckpointFile))
+	if err != nil || len(data) != spoolCheckpointSize {
+		return spoolPosition{}
+	}
+	if crc32.Checksum(data[:16], spoolCRCTable) != binary.BigEndian.Uint32(data[16:]) {
+		return spoolPosition{}
+	}
+	return spoolPosition{
+		segment: binary.BigEndian.Uint64(data),
+		offset:  int64(binary.BigEndian.Uint64(data[8:])),
+	}
+}
+
+func (s *spool) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	s.file.Close()
+	s.file = nil
+	return err
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
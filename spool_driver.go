@@ -0,0 +1,379 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const SpoolDriverIDPostfix = "-spool"
+
+const (
+	defaultSpoolSegmentBytes  = 16 << 20
+	defaultSpoolMaxBytes      = 1 << 30
+	defaultSpoolFsyncInterval = time.Second
+	defaultSpoolBatchSize     = 100
+	defaultSpoolRetryBackoff  = time.Second
+	defaultSpoolMaxRetries    = 10
+)
+
+type spoolConfig struct {
+	Dir             string          `json:"dir"`             // directory of the spool files, one per driver
+	SegmentBytes    int64           `json:"segmentBytes"`    // size a segment file is rotated at; default 16 MiB
+	MaxBytes        int64           `json:"maxBytes"`        // disk usage above which new records are rejected; default 1 GiB
+	Fsync           string          `json:"fsync"`           // "always", "interval" (default) or "never"
+	FsyncIntervalMs int             `json:"fsyncIntervalMs"` // interval fsync period; default 1000
+	BatchSize       int             `json:"batchSize"`       // records delivered between checkpoints; default 100
+	RetryBackoffMs  int             `json:"retryBackoffMs"`  // wait after a failed delivery; default 1000
+	MaxRetries      int             `json:"maxRetries"`      // failed deliveries after which the events are dropped; default 10, -1 never
+	Driver          json.RawMessage `json:"driver"`          // config of the wrapped driver
+}
+
+// SpoolDriverFactory implements DriverFactoryInterface
+type SpoolDriverFactory struct {
+	provider DriverFactoryInterface
+}
+
+func NewSpoolDriverFactory(provider DriverFactoryInterface) *SpoolDriverFactory {
+	return &SpoolDriverFactory{
+		provider: provider,
+	}
+}
+
+func (f *SpoolDriverFactory) DriverID() DriverID {
+	return DriverID(string(f.provider.DriverID()) + SpoolDriverIDPostfix)
+}
+
+func (f *SpoolDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var spoolConfig spoolConfig
+	err := json.Unmarshal(config, &spoolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal spool driver config: %w", err)
+	}
+	if spoolConfig.Dir == "" {
+		return nil, fmt.Errorf("spool dir is required")
+	}
+	switch spoolConfig.Fsync {
+	case "":
+		spoolConfig.Fsync = IntervalFsync
+	case AlwaysFsync, IntervalFsync, NeverFsync:
+	default:
+		return nil, fmt.Errorf("unknown spool fsync policy: %s", spoolConfig.Fsync)
+	}
+	if len(spoolConfig.Driver) == 0 {
+		spoolConfig.Driver = json.RawMessage("{}")
+	}
+
+	provider, err := f.provider.CreateDriver(spoolConfig.Driver)
+	if err != nil {
+		return nil, err
+	}
+	d, err := newSpoolDriver(provider, spoolConfig)
+	if err != nil {
+		provider.Stop()
+		return nil, err
+	}
+	return d, nil
+}
+
+// SpoolDriver implements DriverInterface
+// It appends the records and transaction events to a spool on disk and delivers them to the
+// wrapped driver from a goroutine, so that they survive an outage of the sink and a restart of
+// the process. The read position is checkpointed after the events the wrapped driver accepted
+// without reporting an error; the others are delivered again, so records may be duplicated, and
+// dropped after maxRetries failed deliveries. Delivery is paused while the health check of the
+// wrapped driver fails
+type SpoolDriver struct {
+	errorReporter
+
+	provider      DriverInterface
+	spool         *spool
+	fsync         string
+	fsyncInterval time.Duration
+	batchSize     int
+	retryBackoff  time.Duration
+	maxRetries    int
+	asyncErrors   bool // an error of the wrapped driver may concern any event of the batch
+
+	now func() time.Time
+
+	// delivery goroutine only
+	pos      spoolPosition
+	retryAt  time.Time
+	attempts int // failed deliveries from pos
+
+	failures atomic.Int64 // errors reported by the wrapped driver
+
+	wakeup   chan struct{}
+	flushes  chan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSpoolDriver spools the records in dir, with the default sizes and the interval fsync policy;
+// use the factory config for the others
+func NewSpoolDriver(provider DriverInterface, dir string) (*SpoolDriver, error) {
+	return newSpoolDriver(provider, spoolConfig{Dir: dir, Fsync: IntervalFsync})
+}
+
+func newSpoolDriver(provider DriverInterface, config spoolConfig) (*SpoolDriver, error) {
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = defaultSpoolSegmentBytes
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultSpoolMaxBytes
+	}
+
+	s, pos, err := openSpool(config.Dir, config.SegmentBytes, config.MaxBytes, config.Fsync)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool %s: %w", config.Dir, err)
+	}
+
+	d := &SpoolDriver{
+		provider:      provider,
+		spool:         s,
+		fsync:         config.Fsync,
+		fsyncInterval: defaultSpoolFsyncInterval,
+		batchSize:     defaultSpoolBatchSize,
+		retryBackoff:  defaultSpoolRetryBackoff,
+		maxRetries:    defaultSpoolMaxRetries,
+		asyncErrors:   reportsErrorsAsync(provider),
+		now:           time.Now,
+		pos:           pos,
+		wakeup:        make(chan struct{}, 1),
+		flushes:       make(chan chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if config.FsyncIntervalMs > 0 {
+		d.fsyncInterval = time.Duration(config.FsyncIntervalMs) * time.Millisecond
+	}
+	if config.BatchSize > 0 {
+		d.batchSize = config.BatchSize
+	}
+	if config.RetryBackoffMs > 0 {
+		d.retryBackoff = time.Duration(config.RetryBackoffMs) * time.Millisecond
+	}
+	if config.MaxRetries != 0 {
+		d.maxRetries = config.MaxRetries
+	}
+	setErrorHandler(provider, func(err error) {
+		d.failures.Add(1)
+		d.reportError(err)
+	})
+
+	d.wg.Add(1)
+	go d.run()
+	return d, nil
+}
+
+func (d *SpoolDriver) Log(data map[Param]string) {
+	d.append(WireEvent{Type: WireRecord, Params: data})
+}
+
+func (d *SpoolDriver) BeginTx(id TxID, attr map[Param]string) {
+	d.append(WireEvent{Type: WireTxBegin, TxID: id, Params: attr})
+}
+
+func (d *SpoolDriver) EndTx(id TxID) {
+	d.append(WireEvent{Type: WireTxEnd, TxID: id})
+}
+
+func (d *SpoolDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	d.append(WireEvent{Type: WireTxEnd, TxID: id, Params: map[Param]string{TxStatusParam: string(status)}})
+}
+
+func (d *SpoolDriver) append(event WireEvent) {
+	err := d.spool.append(AppendWireEvent(nil, event))
+	if err != nil {
+		d.reportError(fmt.Errorf("spool: record dropped: %w", err))
+		return
+	}
+	select {
+	case d.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Flush makes the spooled records durable and waits for a delivery attempt
+func (d *SpoolDriver) Flush() {
+	err := d.spool.sync()
+	if err != nil {
+		d.reportError(fmt.Errorf("spool: %w", err))
+	}
+
+	delivered := make(chan struct{})
+	select {
+	case d.flushes <- delivered:
+		<-delivered
+	case <-d.done:
+	}
+}
+
+func (d *SpoolDriver) Dump() {
+	dumpDriver(d.provider)
+}
+
+// Health is the health of the wrapped driver
+func (d *SpoolDriver) Health() error {
+	return driverHealth(d.provider)
+}
+
+// ReportsErrorsAsync is true: the records are delivered from a goroutine
+func (d *SpoolDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+// Stop attempts a last delivery; the records left are delivered after the next start. Later
+// calls do nothing
+func (d *SpoolDriver) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+		d.wg.Wait()
+		err := d.spool.close()
+		if err != nil {
+			d.reportError(fmt.Errorf("spool: %w", err))
+		}
+		d.provider.Stop()
+	})
+}
+
+func (d *SpoolDriver) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(min(d.fsyncInterval, d.retryBackoff))
+	defer ticker.Stop()
+	lastSync := d.now()
+
+	// Records left by a previous run
+	d.deliver()
+	for {
+		select {
+		case <-d.done:
+			d.retryAt = time.Time{}
+			d.deliver()
+			return
+		case <-d.wakeup:
+			d.deliver()
+		case delivered := <-d.flushes:
+			d.retryAt = time.Time{}
+			d.deliver()
+			close(delivered)
+		case <-ticker.C:
+			if d.fsync == IntervalFsync && d.now().Sub(lastSync) >= d.fsyncInterval {
+				err := d.spool.sync()
+				if err != nil {
+					d.reportError(fmt.Errorf("spool: %w", err))
+				}
+				lastSync = d.now()
+			}
+			d.deliver()
+		}
+	}
+}
+
+// deliver passes the spooled events to the wrapped driver, a batch at a time, until the spool is
+// empty or a delivery fails. An event a synchronously reporting driver reports an error for is
+// retried once the events before it are checkpointed; otherwise, or when the error is reported by
+// the flush, the whole batch is retried. The events failing maxRetries times in a row are dropped
+func (d *SpoolDriver) deliver() {
+	for {
+		if d.now().Before(d.retryAt) || driverHealth(d.provider) != nil {
+			return
+		}
+
+		frames, next, err := d.spool.read(d.pos, d.batchSize)
+		if err != nil {
+			// The corrupt frames are skipped
+			d.reportError(err)
+		}
+		if len(frames) == 0 && next == d.pos {
+			return
+		}
+
+		batchFailures := d.failures.Load()
+		failed := -1
+		for i, frame := range frames {
+			event, err := DecodeWireEvent(frame.payload)
+			if err != nil {
+				d.reportError(fmt.Errorf("spool: %w", err))
+				continue
+			}
+			failures := d.failures.Load()
+			d.deliverEvent(event)
+			if !d.asyncErrors && d.failures.Load() != failures {
+				failed = i
+				break
+			}
+		}
+		failures := d.failures.Load()
+		flushDriver(d.provider)
+		if d.failures.Load() != failures || (d.asyncErrors && failures != batchFailures) {
+			// The events passed to the driver are retried together
+			if failed >= 0 {
+				next = frames[failed].end
+				frames = frames[:failed+1]
+			}
+			if d.retry(next, len(frames)) {
+				return
+			}
+			continue
+		}
+		if failed < 0 {
+			d.checkpoint(next)
+			continue
+		}
+
+		// The events before the failed one are delivered
+		if failed > 0 {
+			d.checkpoint(frames[failed-1].end)
+		}
+		if d.retry(frames[failed].end, 1) {
+			return
+		}
+	}
+}
+
+// retry counts a failed delivery of the count events from the read position to end and schedules
+// the next one; the events are dropped after maxRetries failures. It returns whether the delivery
+// has to wait
+func (d *SpoolDriver) retry(end spoolPosition, count int) bool {
+	d.attempts++
+	if d.maxRetries < 0 || d.attempts < d.maxRetries {
+		d.retryAt = d.now().Add(d.retryBackoff)
+		return true
+	}
+	d.reportError(fmt.Errorf("spool: %d events dropped after %d failed deliveries", count, d.attempts))
+	d.checkpoint(end)
+	return false
+}
+
+// checkpoint commits pos as the read position
+func (d *SpoolDriver) checkpoint(pos spoolPosition) {
+	if pos == d.pos {
+		return
+	}
+	d.pos = pos
+	d.attempts = 0
+	err := d.spool.commit(pos)
+	if err != nil {
+		d.reportError(fmt.Errorf("spool: failed to checkpoint: %w", err))
+	}
+}
+
+func (d *SpoolDriver) deliverEvent(event WireEvent) {
+	switch event.Type {
+	case WireRecord:
+		d.provider.Log(event.Params)
+	case WireTxBegin:
+		d.provider.BeginTx(event.TxID, event.Params)
+	case WireTxEnd:
+		if status, ok := event.Params[TxStatusParam]; ok {
+			endTxWithStatus(d.provider, event.TxID, TxStatus(status))
+		} else {
+			d.provider.EndTx(event.TxID)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readSpool(t *testing.T, s *spool, pos spoolPosition) ([]string, spoolPosition) {
+	frames, next, err := s.read(pos, 1000)
+	require.NoError(t, err)
+	return framePayloads(frames), next
+}
+
+func framePayloads(frames []spoolFrame) []string {
+	var payloads []string
+	for _, frame := range frames {
+		payloads = append(payloads, string(frame.payload))
+	}
+	return payloads
+}
+
+// RejectingDriver reports an error for the records with the rejected message
+type RejectingDriver struct {
+	RecordingDriver
+	errorReporter
+	rejected string
+}
+
+func (d *RejectingDriver) Log(data map[Param]string) {
+	if data[MessageParam] == d.rejected {
+		d.reportError(errors.New("rejected"))
+		return
+	}
+	d.RecordingDriver.Log(data)
+}
+
+// LateFailingDriver reports once, on the record with the failing message, the failure of a
+// previous record, as a driver sending batches in the background does
+type LateFailingDriver struct {
+	RecordingDriver
+	errorReporter
+	failing  string
+	reported atomic.Bool
+}
+
+func (d *LateFailingDriver) Log(data map[Param]string) {
+	d.RecordingDriver.Log(data)
+	if data[MessageParam] == d.failing && !d.reported.Swap(true) {
+		d.reportError(errors.New("batch failed"))
+	}
+}
+
+func (d *LateFailingDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+func spoolSegments(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	require.NoError(t, err)
+	for i, match := range matches {
+		matches[i] = filepath.Base(match)
+	}
+	return matches
+}
+
+func TestSpoolDriver_Delivers(t *testing.T) {
+	dir := t.TempDir()
+	provider := &RecordingDriver{}
+	drv, err := NewSpoolDriver(provider, dir)
+	require.NoError(t, err)
+
+	drv.BeginTx(1, map[Param]string{"user": "alice"})
+	drv.Log(map[Param]string{MessageParam: "a", TxIDParam: "1"})
+	drv.Log(map[Param]string{MessageParam: "b", LevelParam: string(Warn), "custom": "x"})
+	drv.EndTxWithStatus(1, TxFailed)
+	drv.BeginTx(2, nil)
+	drv.EndTx(2)
+	drv.Flush()
+
+	records := provider.Records()
+	require.Equal(t, []string{"a", "b"}, messages(records))
+	require.Equal(t, "x", records[1]["custom"])
+	require.Equal(t, []TxID{1, 2}, provider.begins)
+	require.Equal(t, "alice", provider.attrs[1]["user"])
+	require.Equal(t, []TxID{1, 2}, provider.ends)
+	require.Equal(t, TxFailed, provider.Status(1))
+	require.Equal(t, TxStatus(""), provider.Status(2))
+	drv.Stop()
+	require.True(t, provider.stopped)
+
+	// Checkpointed: nothing is delivered again
+	provider = &RecordingDriver{}
+	drv, err = NewSpoolDriver(provider, dir)
+	require.NoError(t, err)
+	drv.Flush()
+	drv.Stop()
+	drv.Stop()
+	require.Empty(t, provider.Records())
+	require.Empty(t, provider.begins)
+}
+
+func TestSpoolDriver_RedeliversAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	sink := &FlakyDriver{}
+	unhealthy := errors.New("disconnected")
+	sink.health.Store(&unhealthy)
+	drv, err := NewSpoolDriver(sink, dir)
+	require.NoError(t, err)
+
+	drv.Log(map[Param]string{MessageParam: "a"})
+	drv.Log(map[Param]string{MessageParam: "b"})
+	// Held while the sink is unhealthy, including on stop
+	drv.Flush()
+	require.EqualError(t, drv.Health(), "disconnected")
+	drv.Stop()
+	require.Empty(t, sink.Records())
+
+	provider := &RecordingDriver{}
+	drv, err = NewSpoolDriver(provider, dir)
+	require.NoError(t, err)
+	drv.Log(map[Param]string{MessageParam: "c"})
+	drv.Flush()
+	drv.Stop()
+	require.Equal(t, []string{"a", "b", "c"}, messages(provider.Records()))
+}
+
+func TestSpoolDriver_RetriesFailedBatch(t *testing.T) {
+	sink := &FlakyDriver{}
+	drv, err := NewSpoolDriver(sink, t.TempDir())
+	require.NoError(t, err)
+	defer drv.Stop()
+	var mutex sync.Mutex
+	var reported []error
+	drv.SetErrorHandler(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported = append(reported, err)
+	})
+
+	sink.down.Store(true)
+	drv.Log(map[Param]string{MessageParam: "a"})
+	drv.Log(map[Param]string{MessageParam: "b"})
+	drv.Flush()
+	require.Empty(t, sink.Records())
+
+	sink.down.Store(false)
+	drv.Flush()
+	require.Equal(t, []string{"a", "b"}, messages(sink.Records()))
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.NotEmpty(t, reported)
+	require.EqualError(t, reported[0], "sink down")
+}
+
+func TestSpoolDriver_DropsRejectedRecord(t *testing.T) {
+	sink := &RejectingDriver{rejected: "poison"}
+	drv, err := newSpoolDriver(sink, spoolConfig{Dir: t.TempDir(), Fsync: NeverFsync, MaxRetries: 3})
+	require.NoError(t, err)
+	defer drv.Stop()
+	var mutex sync.Mutex
+	var reported []string
+	drv.SetErrorHandler(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported = append(reported, err.Error())
+	})
+
+	drv.Log(map[Param]string{MessageParam: "a"})
+	drv.Log(map[Param]string{MessageParam: "poison"})
+	drv.Log(map[Param]string{MessageParam: "b"})
+	// Each flush retries without waiting for the backoff
+	for i := 0; i < 5 && len(sink.Records()) < 2; i++ {
+		drv.Flush()
+	}
+
+	// The records accepted before the rejected one aren't delivered again
+	require.Equal(t, []string{"a", "b"}, messages(sink.Records()))
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, []string{"rejected", "rejected", "rejected", "spool: 1 events dropped after 3 failed deliveries"}, reported)
+}
+
+func TestSpoolDriver_RetriesBatchOfAsyncDriver(t *testing.T) {
+	sink := &LateFailingDriver{failing: "c"}
+	drv, err := newSpoolDriver(sink, spoolConfig{Dir: t.TempDir(), Fsync: NeverFsync})
+	require.NoError(t, err)
+	defer drv.Stop()
+	drv.SetErrorHandler(func(error) {})
+
+	drv.Log(map[Param]string{MessageParam: "a"})
+	drv.Log(map[Param]string{MessageParam: "b"})
+	drv.Log(map[Param]string{MessageParam: "c"})
+	for i := 0; i < 5 && len(sink.Records()) < 6; i++ {
+		drv.Flush()
+	}
+
+	// The error doesn't tell which record failed: all are delivered again
+	require.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, messages(sink.Records()))
+}
+
+func TestSpool_SkipsCorruptFrameOfLastSegment(t *testing.T) {
+	dir := t.TempDir()
+	s, pos, err := openSpool(dir, 1<<20, 1<<30, NeverFsync)
+	require.NoError(t, err)
+	defer s.close()
+	for _, payload := range []string{"record-0", "record-1", "record-2"} {
+		require.NoError(t, s.append([]byte(payload)))
+	}
+
+	// Corrupt the payload of record-1
+	frame := int64(spoolFrameHeaderSize + len("record-0"))
+	file, err := os.OpenFile(s.segmentPath(pos.segment), os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("X"), frame+spoolFrameHeaderSize)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	frames, next, err := s.read(pos, 10)
+	require.EqualError(t, err, fmt.Sprintf("spool: corrupt frame in segment %d at offset %d", pos.segment, frame))
+	require.Equal(t, []string{"record-0"}, framePayloads(frames))
+	require.Equal(t, spoolPosition{segment: pos.segment, offset: 3 * frame}, next)
+
+	// The reading continues with the frames appended after the corrupt one
+	require.NoError(t, s.append([]byte("record-3")))
+	read, _ := readSpool(t, s, next)
+	require.Equal(t, []string{"record-3"}, read)
+}
+
+func TestSpool_RecoversTornTail(t *testing.T) {
+	frame := int64(spoolFrameHeaderSize + len("record-2"))
+	for name, cut := range map[string]int64{
+		"mid payload": 2*frame + spoolFrameHeaderSize + 3,
+		"mid header":  2*frame + 5,
+		"bad crc":     -1,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, pos, err := openSpool(dir, 1<<20, 1<<30, NeverFsync)
+			require.NoError(t, err)
+			for _, payload := range []string{"record-0", "record-1", "record-2"} {
+				require.NoError(t, s.append([]byte(payload)))
+			}
+			require.NoError(t, s.close())
+
+			path := s.segmentPath(pos.segment)
+			if cut >= 0 {
+				require.NoError(t, os.Truncate(path, cut))
+			} else {
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				data[len(data)-1] ^= 0xff
+				require.NoError(t, os.WriteFile(path, data, 0644))
+			}
+
+			s, pos, err = openSpool(dir, 1<<20, 1<<30, NeverFsync)
+			require.NoError(t, err)
+			defer s.close()
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			require.Equal(t, 2*frame, info.Size())
+
+			// Appends continue at the last complete frame
+			require.NoError(t, s.append([]byte("record-3")))
+			read, _ := readSpool(t, s, pos)
+			require.Equal(t, []string{"record-0", "record-1", "record-3"}, read)
+		})
+	}
+}
+
+func TestSpool_SegmentsAndCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	frame := int64(spoolFrameHeaderSize + len("record-0"))
+	s, pos, err := openSpool(dir, 2*frame, 1<<30, AlwaysFsync)
+	require.NoError(t, err)
+	for _, payload := range []string{"record-0", "record-1", "record-2", "record-3", "record-4"} {
+		require.NoError(t, s.append([]byte(payload)))
+	}
+	require.Len(t, spoolSegments(t, dir), 3)
+
+	payloads, next, err := s.read(pos, 3)
+	require.NoError(t, err)
+	require.Len(t, payloads, 3)
+	require.NoError(t, s.commit(next))
+	// The delivered segment is deleted, the partly delivered one is kept
+	require.Len(t, spoolSegments(t, dir), 2)
+	require.NoError(t, s.close())
+
+	// A crash mid-write of the last segment
+	segments := spoolSegments(t, dir)
+	require.NoError(t, os.Truncate(filepath.Join(dir, segments[len(segments)-1]), frame-1))
+
+	s, pos, err = openSpool(dir, 2*frame, 1<<30, AlwaysFsync)
+	require.NoError(t, err)
+	defer s.close()
+	require.Equal(t, next, pos)
+	read, end := readSpool(t, s, pos)
+	require.Equal(t, []string{"record-3"}, read)
+
+	require.NoError(t, s.append([]byte("record-5")))
+	read, _ = readSpool(t, s, end)
+	require.Equal(t, []string{"record-5"}, read)
+}
+
+func TestSpool_MaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	frame := int64(spoolFrameHeaderSize + len("record-0"))
+	s, pos, err := openSpool(dir, frame, 2*frame, NeverFsync)
+	require.NoError(t, err)
+	defer s.close()
+
+	require.NoError(t, s.append([]byte("record-0")))
+	require.NoError(t, s.append([]byte("record-1")))
+	require.ErrorIs(t, s.append([]byte("record-2")), errSpoolFull)
+
+	// Delivered segments free the space
+	_, next, err := s.read(pos, 1)
+	require.NoError(t, err)
+	require.NoError(t, s.commit(next))
+	require.NoError(t, s.append([]byte("record-2")))
+}
+
+func TestSpool_MaxBytesWithinSegment(t *testing.T) {
+	dir := t.TempDir()
+	frame := int64(spoolFrameHeaderSize + len("record-0"))
+	s, pos, err := openSpool(dir, 2*frame, 2*frame, NeverFsync)
+	require.NoError(t, err)
+	defer s.close()
+
+	require.NoError(t, s.append([]byte("record-0")))
+	require.NoError(t, s.append([]byte("record-1")))
+	require.ErrorIs(t, s.append([]byte("record-2")), errSpoolFull)
+
+	// The segment written is released once delivered
+	read, next := readSpool(t, s, pos)
+	require.Len(t, read, 2)
+	require.NoError(t, s.commit(next))
+	require.NoError(t, s.append([]byte("record-2")))
+	require.Len(t, spoolSegments(t, dir), 1)
+
+	read, _ = readSpool(t, s, next)
+	require.Equal(t, []string{"record-2"}, read)
+}
+
+func TestSpoolDriverFactory(t *testing.T) {
+	dir := t.TempDir()
+	factory := NewSpoolDriverFactory(&FileDriverFactory{})
+	require.Equal(t, DriverID("file-spool"), factory.DriverID())
+
+	logPath := filepath.Join(dir, "app.log")
+	drv, err := factory.CreateDriver(json.RawMessage(`{"dir":"` + filepath.Join(dir, "spool") + `","fsync":"always",
+		"segmentBytes":4096,"batchSize":10,"maxRetries":-1,"driver":{"filePath":"` + logPath + `"}}`))
+	require.NoError(t, err)
+	spool := drv.(*SpoolDriver)
+	require.Equal(t, AlwaysFsync, spool.fsync)
+	require.Equal(t, int64(4096), spool.spool.segmentBytes)
+	require.Equal(t, 10, spool.batchSize)
+	require.Equal(t, -1, spool.maxRetries)
+
+	drv.Log(map[Param]string{MessageParam: "spooled", LevelParam: string(Info), TimeParam: "1000"})
+	spool.Flush()
+	drv.Stop()
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	// Delivered with the time of the record
+	require.Contains(t, string(data), "[1000      ] INFO  spooled")
+
+	for _, config := range []string{
+		`{}`,
+		`{"dir":"` + dir + `","fsync":"sometimes"}`,
+	} {
+		_, err = factory.CreateDriver(json.RawMessage(config))
+		require.Error(t, err, config)
+	}
+}
@@ -0,0 +1,338 @@
+package logsystem
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const SyslogDriverID = "syslog"
+
+const (
+	defaultSyslogSocket = "/dev/log"
+	// Enterprise number 32473 is reserved for documentation (RFC 5612)
+	defaultSyslogSDID = "logsystem@32473"
+	syslogDialTimeout = 5 * time.Second
+)
+
+const (
+	OctetCountingFraming = "octet-counting"
+	NewlineFraming       = "newline"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[LogLevel]int{
+	Error: 3,
+	Warn:  4,
+	Info:  6,
+	Debug: 7,
+}
+
+type syslogConfig struct {
+	Network  string `json:"network"`  // udp (default), tcp, tls, unixgram or unix
+	Address  string `json:"address"`  // host:port or socket path; defaults to /dev/log for unix networks
+	Facility string `json:"facility"` // defaults to user
+	AppName  string `json:"appName"`  // defaults to the executable name
+	Hostname string `json:"hostname"` // defaults to os.Hostname
+	Framing  string `json:"framing"`  // stream networks only: octet-counting (default) or newline, escaping the line breaks as #012
+	SDID     string `json:"sdID"`     // structured data ID carrying the params
+
+	CAFile             string `json:"caFile"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+// SyslogDriverFactory implements DriverFactoryInterface
+type SyslogDriverFactory struct {
+}
+
+func (f *SyslogDriverFactory) DriverID() DriverID {
+	return DriverID(SyslogDriverID)
+}
+
+func (f *SyslogDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var syslogConfig syslogConfig
+	err := json.Unmarshal(config, &syslogConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal syslog driver config: %w", err)
+	}
+
+	d, err := newSyslogDriver(syslogConfig)
+	if err != nil {
+		return nil, err
+	}
+	return NewSerialDriver(d), nil
+}
+
+// SyslogDriver implements DriverInterface
+// It sends RFC 5424 messages; the tx ID, component and the other params are carried as structured data.
+// It isn't safe for concurrent use; the factory wraps it by SerialDriver
+type SyslogDriver struct {
+	errorReporter
+
+	config   syslogConfig
+	facility int
+	procID   string
+	conn     net.Conn
+	dial     func() (net.Conn, error)
+}
+
+func newSyslogDriver(config syslogConfig) (*SyslogDriver, error) {
+	if config.Network == "" {
+		config.Network = "udp"
+	}
+	if config.Address == "" && strings.HasPrefix(config.Network, "unix") {
+		config.Address = defaultSyslogSocket
+	}
+	if config.Facility == "" {
+		config.Facility = "user"
+	}
+	if config.AppName == "" {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	if config.Framing == "" {
+		config.Framing = OctetCountingFraming
+	}
+	if config.SDID == "" {
+		config.SDID = defaultSyslogSDID
+	}
+
+	facility, ok := syslogFacilities[config.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility: %s", config.Facility)
+	}
+	if config.Framing != OctetCountingFraming && config.Framing != NewlineFraming {
+		return nil, fmt.Errorf("unknown syslog framing: %s", config.Framing)
+	}
+
+	d := &SyslogDriver{
+		config:   config,
+		facility: facility,
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+
+	switch config.Network {
+	case "udp", "tcp", "unixgram", "unix":
+		d.dial = func() (net.Conn, error) {
+			return net.DialTimeout(config.Network, config.Address, syslogDialTimeout)
+		}
+	case "tls":
+		tlsConfig, err := syslogTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		d.dial = func() (net.Conn, error) {
+			dialer := &net.Dialer{Timeout: syslogDialTimeout}
+			return tls.DialWithDialer(dialer, "tcp", config.Address, tlsConfig)
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog network: %s", config.Network)
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog %s %s: %w", config.Network, config.Address, err)
+	}
+	d.conn = conn
+
+	return d, nil
+}
+
+func syslogTLSConfig(config syslogConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if host, _, err := net.SplitHostPort(config.Address); err == nil {
+		tlsConfig.ServerName = host
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in syslog CA file: %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func (d *SyslogDriver) Log(data map[Param]string) {
+	d.send(d.formatMessage(data, "-"))
+}
+
+func (d *SyslogDriver) BeginTx(id TxID, attr map[Param]string) {
+	txData := make(map[Param]string)
+	for k, v := range attr {
+		txData[k] = v
+	}
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX Begin"
+	txData[LevelParam] = string(Info)
+	d.send(d.formatMessage(txData, "txBegin"))
+}
+
+func (d *SyslogDriver) EndTx(id TxID) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[MessageParam] = "TX End"
+	txData[LevelParam] = string(Info)
+	d.send(d.formatMessage(txData, "txEnd"))
+}
+
+func (d *SyslogDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	txData := make(map[Param]string)
+	txData[TxIDParam] = id.String()
+	txData[TxStatusParam] = string(status)
+	txData[MessageParam] = fmt.Sprintf("TX End; Status: %s", status)
+	txData[LevelParam] = string(Info)
+	if status == TxFailed {
+		txData[LevelParam] = string(Error)
+	}
+	d.send(d.formatMessage(txData, "txEnd"))
+}
+
+func (d *SyslogDriver) Stop() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
+
+// formatMessage renders "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG"
+func (d *SyslogDriver) formatMessage(data map[Param]string, msgID string) string {
+	p := extractKnownParams(data)
+
+	severity, ok := syslogSeverities[LogLevel(strings.ToLower(p.Level))]
+	if !ok {
+		severity = syslogSeverities[Info]
+	}
+
+	timestamp := time.Unix(p.Timestamp, 0).UTC().Format(time.RFC3339)
+
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s",
+		d.facility*8+severity,
+		timestamp,
+		syslogHeaderField(d.config.Hostname, 255),
+		syslogHeaderField(d.config.AppName, 48),
+		syslogHeaderField(d.procID, 128),
+		syslogHeaderField(msgID, 32),
+		d.structuredData(data),
+		p.Message,
+	)
+}
+
+// structuredData carries every param except message, time and level as SD-PARAMs
+func (d *SyslogDriver) structuredData(data map[Param]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if k == MessageParam || k == TimeParam || k == LevelParam {
+			continue
+		}
+		keys = append(keys, string(k))
+	}
+	if len(keys) == 0 {
+		return "-"
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString("[")
+	sb.WriteString(d.config.SDID)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, ` %s="%s"`, syslogSDName(k), syslogSDValueEscaper.Replace(data[Param(k)]))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// syslogNewlineEscaper escapes the line breaks of the messages, e.g. of a stack trace, with the
+// octal escapes of rsyslog, so that the newline framing keeps a message on one line
+var syslogNewlineEscaper = strings.NewReplacer("\n", "#012", "\r", "#015")
+
+func (d *SyslogDriver) send(message string) {
+	frame := message
+	if !isDatagramNetwork(d.config.Network) {
+		if d.config.Framing == NewlineFraming {
+			frame = syslogNewlineEscaper.Replace(message) + "\n"
+		} else {
+			frame = fmt.Sprintf("%d %s", len(message), message)
+		}
+	}
+
+	err := d.write([]byte(frame))
+	if err != nil {
+		// The collector may have restarted; reconnect once
+		d.Stop()
+		err = d.write([]byte(frame))
+	}
+	if err != nil {
+		d.reportError(fmt.Errorf("failed to send syslog message: %w", err))
+	}
+}
+
+func (d *SyslogDriver) write(frame []byte) error {
+	if d.conn == nil {
+		conn, err := d.dial()
+		if err != nil {
+			return err
+		}
+		d.conn = conn
+	}
+	_, err := d.conn.Write(frame)
+	return err
+}
+
+func isDatagramNetwork(network string) bool {
+	return network == "udp" || network == "unixgram"
+}
+
+var syslogSDValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogSDName keeps the printable US-ASCII characters allowed in an SD-NAME
+func syslogSDName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(sanitized) > 32 {
+		sanitized = sanitized[:32]
+	}
+	return sanitized
+}
+
+// syslogHeaderField replaces an empty value by the NILVALUE and truncates it to the maximum length
+func syslogHeaderField(value string, maxLen int) string {
+	if value == "" {
+		return "-"
+	}
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+package logsystem
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createSyslogDriver(t *testing.T, config string) DriverInterface {
+	drv, err := (&SyslogDriverFactory{}).CreateDriver(json.RawMessage(config))
+	require.NoError(t, err)
+	_, ok := drv.(*SerialDriver)
+	require.True(t, ok)
+	t.Cleanup(drv.Stop)
+	return drv
+}
+
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 64*1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestSyslogDriver_UDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createSyslogDriver(t, `{"network":"udp","address":"`+listener.LocalAddr().String()+`","facility":"local3","appName":"app","hostname":"host"}`)
+	drv.Log(map[Param]string{
+		MessageParam:   "disk almost full",
+		LevelParam:     string(Warn),
+		TxIDParam:      "7",
+		ComponentParam: `storage "main"`,
+	})
+
+	msg := readDatagram(t, listener)
+	// local3 (19) * 8 + warning (4)
+	require.True(t, strings.HasPrefix(msg, "<156>1 "), msg)
+	fields := strings.SplitN(msg, " ", 7)
+	require.Equal(t, "host", fields[2])
+	require.Equal(t, "app", fields[3])
+	require.Equal(t, "-", fields[5])
+	require.Equal(t, `[logsystem@32473 component="storage \"main\"" txID="7"] disk almost full`, fields[6])
+}
+
+func TestSyslogDriver_TCPOctetCounting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createSyslogDriver(t, `{"network":"tcp","address":"`+listener.Addr().String()+`"}`)
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	drv.BeginTx(3, map[Param]string{"UserID": "123"})
+	drv.Log(map[Param]string{MessageParam: "failed", LevelParam: string(Error)})
+	drv.Log(map[Param]string{MessageParam: "panic", LevelParam: string(Error), StackParam: "main.f\n\tmain.go:10"})
+
+	reader := bufio.NewReader(conn)
+	readFrame := func() string {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		length, err := reader.ReadString(' ')
+		require.NoError(t, err)
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		require.NoError(t, err)
+		frame := make([]byte, n)
+		_, err = io.ReadFull(reader, frame)
+		require.NoError(t, err)
+		return string(frame)
+	}
+
+	begin := readFrame()
+	require.True(t, strings.HasPrefix(begin, "<14>1 "), begin)
+	require.Contains(t, begin, ` txBegin [logsystem@32473 UserID="123" txID="3"] TX Begin`)
+
+	failed := readFrame()
+	require.True(t, strings.HasPrefix(failed, "<11>1 "), failed)
+	require.True(t, strings.HasSuffix(failed, " - - failed"), failed)
+
+	// The line breaks are part of the counted frame
+	panicked := readFrame()
+	require.True(t, strings.HasSuffix(panicked, ` [logsystem@32473 stack="main.f`+"\n\t"+`main.go:10"] panic`), panicked)
+}
+
+func TestSyslogDriver_TCPNewlineFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createSyslogDriver(t, `{"network":"tcp","address":"`+listener.Addr().String()+`","framing":"newline"}`)
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	drv.Log(map[Param]string{MessageParam: "panic", LevelParam: string(Error), StackParam: "main.f\r\n\tmain.go:10"})
+	drv.Log(map[Param]string{MessageParam: "next"})
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(line, ` [logsystem@32473 stack="main.f#015#012`+"\t"+`main.go:10"] panic`+"\n"), line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(line, " - - next\n"), line)
+}
+
+func TestSyslogDriver_Unixgram(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log.sock")
+	listener, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	drv := createSyslogDriver(t, `{"network":"unixgram","address":"`+socket+`","facility":"daemon"}`)
+	drv.EndTx(5)
+
+	msg := readDatagram(t, listener)
+	require.True(t, strings.HasPrefix(msg, "<30>1 "), msg)
+	require.True(t, strings.HasSuffix(msg, ` txEnd [logsystem@32473 txID="5"] TX End`), msg)
+}
+
+func TestSyslogDriver_InvalidConfig(t *testing.T) {
+	_, err := (&SyslogDriverFactory{}).CreateDriver(json.RawMessage(`{"facility":"nope"}`))
+	require.Error(t, err)
+	_, err = (&SyslogDriverFactory{}).CreateDriver(json.RawMessage(`{"network":"carrier-pigeon"}`))
+	require.Error(t, err)
+}
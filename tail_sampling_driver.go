@@ -0,0 +1,246 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const TailSamplingDriverIDPostfix = "-tailsampling"
+
+const (
+	defaultTailSamplingMaxTxRecords = 1000
+	defaultTailSamplingMaxBuffered  = 10000
+)
+
+// Params of the summary forwarded for the transactions sampled out
+const (
+	DroppedRecordsParam Param = "droppedRecords"
+	DurationMsParam     Param = "durationMs"
+)
+
+type tailSamplingConfig struct {
+	DurationThresholdMs int             `json:"durationThresholdMs"` // keep the transactions lasting at least this long; 0 disables
+	SampleRate          float64         `json:"sampleRate"`          // share of the other transactions kept, 0 to 1
+	MaxTxRecords        int             `json:"maxTxRecords"`        // records held per transaction; default 1000
+	MaxBuffered         int             `json:"maxBuffered"`         // records held for all transactions; default 10000
+	Driver              json.RawMessage `json:"driver"`              // config of the wrapped driver
+}
+
+// TailSamplingDriverFactory implements DriverFactoryInterface
+type TailSamplingDriverFactory struct {
+	provider DriverFactoryInterface
+}
+
+func NewTailSamplingDriverFactory(provider DriverFactoryInterface) *TailSamplingDriverFactory {
+	return &TailSamplingDriverFactory{
+		provider: provider,
+	}
+}
+
+func (f *TailSamplingDriverFactory) DriverID() DriverID {
+	return DriverID(string(f.provider.DriverID()) + TailSamplingDriverIDPostfix)
+}
+
+func (f *TailSamplingDriverFactory) CreateDriver(config json.RawMessage) (DriverInterface, error) {
+	var samplingConfig tailSamplingConfig
+	err := json.Unmarshal(config, &samplingConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tail sampling driver config: %w", err)
+	}
+	if samplingConfig.SampleRate < 0 || samplingConfig.SampleRate > 1 {
+		return nil, fmt.Errorf("tail sampling rate must be between 0 and 1")
+	}
+	if len(samplingConfig.Driver) == 0 {
+		samplingConfig.Driver = json.RawMessage("{}")
+	}
+
+	provider, err := f.provider.CreateDriver(samplingConfig.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	d := NewTailSamplingDriver(provider, samplingConfig.SampleRate)
+	d.durationThreshold = time.Duration(samplingConfig.DurationThresholdMs) * time.Millisecond
+	if samplingConfig.MaxTxRecords > 0 {
+		d.maxTxRecords = samplingConfig.MaxTxRecords
+	}
+	if samplingConfig.MaxBuffered > 0 {
+		d.maxBuffered = samplingConfig.MaxBuffered
+	}
+	return d, nil
+}
+
+type sampledTx struct {
+	id      TxID
+	attr    map[Param]string
+	start   time.Time
+	records []map[Param]string
+	keep    bool // a Warn/Error record was logged
+	// the buffer limits were reached; the transaction is forwarded as it goes
+	passThrough bool
+}
+
+// TailSamplingDriver implements DriverInterface
+// It holds the records of each open transaction and decides at its end whether to forward
+// them: transactions with a Warn/Error record, a failed status, lasting longer than the
+// threshold or picked by the sample rate are forwarded in full, the others as a summary record.
+// Records outside transactions are forwarded right away
+type TailSamplingDriver struct {
+	provider          DriverInterface
+	sampleRate        float64
+	durationThreshold time.Duration
+	maxTxRecords      int
+	maxBuffered       int
+
+	now    func() time.Time
+	sample func() float64
+
+	mutex    sync.Mutex
+	txs      map[string]*sampledTx
+	buffered int
+}
+
+func NewTailSamplingDriver(provider DriverInterface, sampleRate float64) *TailSamplingDriver {
+	return &TailSamplingDriver{
+		provider:     provider,
+		sampleRate:   sampleRate,
+		maxTxRecords: defaultTailSamplingMaxTxRecords,
+		maxBuffered:  defaultTailSamplingMaxBuffered,
+		now:          time.Now,
+		sample:       rand.Float64,
+		txs:          make(map[string]*sampledTx),
+	}
+}
+
+func (d *TailSamplingDriver) Log(data map[Param]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	tx, ok := d.txs[data[TxIDParam]]
+	if !ok || tx.passThrough {
+		d.provider.Log(data)
+		return
+	}
+
+	level := LogLevel(data[LevelParam])
+	if level == Warn || level == Error {
+		tx.keep = true
+	}
+	tx.records = append(tx.records, data)
+	d.buffered++
+
+	if len(tx.records) >= d.maxTxRecords || d.buffered >= d.maxBuffered {
+		d.forwardRecords(tx)
+		tx.passThrough = true
+	}
+}
+
+func (d *TailSamplingDriver) BeginTx(id TxID, attr map[Param]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.txs[id.String()] = &sampledTx{
+		id:    id,
+		attr:  attr,
+		start: d.now(),
+	}
+}
+
+func (d *TailSamplingDriver) EndTx(id TxID) {
+	d.endTx(id, "")
+}
+
+func (d *TailSamplingDriver) EndTxWithStatus(id TxID, status TxStatus) {
+	d.endTx(id, status)
+}
+
+func (d *TailSamplingDriver) endTx(id TxID, status TxStatus) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	tx, ok := d.txs[id.String()]
+	if !ok {
+		d.forwardEndTx(id, status)
+		return
+	}
+	delete(d.txs, id.String())
+
+	duration := d.now().Sub(tx.start)
+	keep := tx.passThrough || tx.keep || status == TxFailed ||
+		(d.durationThreshold > 0 && duration >= d.durationThreshold) ||
+		d.sample() < d.sampleRate
+	if keep {
+		d.forwardRecords(tx)
+	} else {
+		d.buffered -= len(tx.records)
+		d.provider.BeginTx(id, tx.attr)
+		d.provider.Log(map[Param]string{
+			TxIDParam:           id.String(),
+			LevelParam:          string(Info),
+			MessageParam:        fmt.Sprintf("TX sampled out; %d records dropped", len(tx.records)),
+			DroppedRecordsParam: strconv.Itoa(len(tx.records)),
+			DurationMsParam:     strconv.FormatInt(duration.Milliseconds(), 10),
+		})
+	}
+	d.forwardEndTx(id, status)
+}
+
+// forwardRecords forwards the begin of the transaction and its held records, unless done already
+func (d *TailSamplingDriver) forwardRecords(tx *sampledTx) {
+	if tx.passThrough {
+		return
+	}
+	d.provider.BeginTx(tx.id, tx.attr)
+	for _, record := range tx.records {
+		d.provider.Log(record)
+	}
+	d.buffered -= len(tx.records)
+	tx.records = nil
+}
+
+func (d *TailSamplingDriver) forwardEndTx(id TxID, status TxStatus) {
+	if status == "" {
+		d.provider.EndTx(id)
+		return
+	}
+	endTxWithStatus(d.provider, id, status)
+}
+
+func (d *TailSamplingDriver) Flush() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	flushDriver(d.provider)
+}
+
+func (d *TailSamplingDriver) Dump() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	dumpDriver(d.provider)
+}
+
+func (d *TailSamplingDriver) SetErrorHandler(handler func(err error)) {
+	setErrorHandler(d.provider, handler)
+}
+
+func (d *TailSamplingDriver) Health() error {
+	return driverHealth(d.provider)
+}
+
+// ReportsErrorsAsync is true: the records are written when their transaction ends
+func (d *TailSamplingDriver) ReportsErrorsAsync() bool {
+	return true
+}
+
+// Stop forwards the records of the transactions still open, as their outcome is unknown
+func (d *TailSamplingDriver) Stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, tx := range d.txs {
+		d.forwardRecords(tx)
+	}
+	d.txs = make(map[string]*sampledTx)
+	d.provider.Stop()
+}
@@ -0,0 +1,125 @@
+package logsystem
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailSamplingDriver_KeepsInterestingTransactions(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewTailSamplingDriver(provider, 0)
+
+	drv.Log(map[Param]string{MessageParam: "outside"})
+	drv.BeginTx(1, nil)
+	drv.Log(map[Param]string{MessageParam: "debug 1", TxIDParam: "1", LevelParam: string(Debug)})
+	drv.Log(map[Param]string{MessageParam: "warn 1", TxIDParam: "1", LevelParam: string(Warn)})
+	require.Equal(t, []string{"outside"}, messages(provider.Records()))
+	require.Empty(t, provider.begins)
+
+	drv.EndTx(1)
+	require.Equal(t, []string{"outside", "debug 1", "warn 1"}, messages(provider.Records()))
+	require.Equal(t, []TxID{1}, provider.begins)
+	require.Equal(t, []TxID{1}, provider.ends)
+
+	// A failed status keeps the transaction too
+	drv.BeginTx(2, nil)
+	drv.Log(map[Param]string{MessageParam: "debug 2", TxIDParam: "2", LevelParam: string(Debug)})
+	drv.EndTxWithStatus(2, TxFailed)
+	require.Equal(t, "debug 2", provider.Records()[3][MessageParam])
+	require.Equal(t, TxFailed, provider.Status(2))
+	require.Zero(t, drv.buffered)
+}
+
+func TestTailSamplingDriver_SummaryForSampledOut(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewTailSamplingDriver(provider, 0.5)
+	now := time.Unix(100, 0)
+	drv.now = func() time.Time { return now }
+	drv.sample = func() float64 { return 0.7 }
+	drv.durationThreshold = time.Second
+
+	drv.BeginTx(1, nil)
+	drv.Log(map[Param]string{MessageParam: "a", TxIDParam: "1", LevelParam: string(Info)})
+	drv.Log(map[Param]string{MessageParam: "b", TxIDParam: "1", LevelParam: string(Debug)})
+	now = now.Add(300 * time.Millisecond)
+	drv.EndTxWithStatus(1, TxSucceeded)
+
+	records := provider.Records()
+	require.Len(t, records, 1)
+	require.Equal(t, "TX sampled out; 2 records dropped", records[0][MessageParam])
+	require.Equal(t, "2", records[0][DroppedRecordsParam])
+	require.Equal(t, "300", records[0][DurationMsParam])
+	require.Equal(t, "1", records[0][TxIDParam])
+	require.Equal(t, []TxID{1}, provider.begins)
+	require.Equal(t, TxSucceeded, provider.Status(1))
+	require.Zero(t, drv.buffered)
+
+	// Picked by the sample rate
+	drv.sample = func() float64 { return 0.2 }
+	drv.BeginTx(2, nil)
+	drv.Log(map[Param]string{MessageParam: "c", TxIDParam: "2"})
+	drv.EndTx(2)
+	require.Equal(t, "c", provider.Records()[1][MessageParam])
+
+	// Exceeding the duration threshold
+	drv.sample = func() float64 { return 0.7 }
+	drv.BeginTx(3, nil)
+	drv.Log(map[Param]string{MessageParam: "d", TxIDParam: "3"})
+	now = now.Add(time.Second)
+	drv.EndTx(3)
+	require.Equal(t, "d", provider.Records()[2][MessageParam])
+}
+
+func TestTailSamplingDriver_BoundedBuffering(t *testing.T) {
+	provider := &RecordingDriver{}
+	drv := NewTailSamplingDriver(provider, 0)
+	drv.maxTxRecords = 2
+	drv.maxBuffered = 3
+
+	drv.BeginTx(1, nil)
+	drv.Log(map[Param]string{MessageParam: "1a", TxIDParam: "1"})
+	drv.Log(map[Param]string{MessageParam: "1b", TxIDParam: "1"})
+	// Transaction 1 reached maxTxRecords and is forwarded as it goes
+	require.Equal(t, []string{"1a", "1b"}, messages(provider.Records()))
+	drv.Log(map[Param]string{MessageParam: "1c", TxIDParam: "1"})
+	require.Len(t, provider.Records(), 3)
+
+	drv.BeginTx(2, nil)
+	drv.BeginTx(3, nil)
+	drv.Log(map[Param]string{MessageParam: "2a", TxIDParam: "2"})
+	drv.Log(map[Param]string{MessageParam: "3a", TxIDParam: "3"})
+	drv.Log(map[Param]string{MessageParam: "3b", TxIDParam: "3"})
+	// maxTxRecords for 3
+	require.Equal(t, []string{"3a", "3b"}, messages(provider.Records()[3:]))
+
+	drv.EndTx(1)
+	drv.EndTx(3)
+	require.Equal(t, []TxID{1, 3}, provider.begins)
+	require.Equal(t, 1, drv.buffered)
+
+	// Open transactions are forwarded in full at Stop
+	drv.Stop()
+	require.Equal(t, "2a", provider.Records()[5][MessageParam])
+	require.Equal(t, []TxID{1, 3, 2}, provider.begins)
+	require.True(t, provider.stopped)
+}
+
+func TestTailSamplingDriverFactory(t *testing.T) {
+	provider := &RecordingDriver{}
+	factory := NewTailSamplingDriverFactory(&RecordingDriverFactory{id: "recording", driver: provider})
+	require.Equal(t, DriverID("recording-tailsampling"), factory.DriverID())
+
+	drv, err := factory.CreateDriver(json.RawMessage(`{"durationThresholdMs":50,"sampleRate":0.1,"maxTxRecords":5,"driver":{}}`))
+	require.NoError(t, err)
+	sampling := drv.(*TailSamplingDriver)
+	require.Equal(t, 50*time.Millisecond, sampling.durationThreshold)
+	require.Equal(t, 0.1, sampling.sampleRate)
+	require.Equal(t, 5, sampling.maxTxRecords)
+	require.Equal(t, defaultTailSamplingMaxBuffered, sampling.maxBuffered)
+
+	_, err = factory.CreateDriver(json.RawMessage(`{"sampleRate":2}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,362 @@
+package logsystem
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Binary wire protocol for records and transaction events.
+//
+// Frame (version 1):
+//
+//	version:u8 type:u8 [txID:i64, tx events only] strings attributes
+//	strings    = count:uvarint { length:uvarint bytes }
+//	attributes = count:uvarint { key:u32 value }
+//
+// The predefined params have numeric keys; time, level, txID and line have fixed size values
+// (i64, u8, i64, u32) and the others are length:uvarint bytes. The application params use a
+// key with the high bit set and the index of their name in the string table; their values are
+// length:uvarint bytes. Values that don't have the canonical form of their fixed size type,
+// e.g. a non numeric time, are sent as application params so that decoding gives back the
+// same map. Integers are big endian.
+//
+// On streams and in files each frame is preceded by its length as u32.
+
+const WireVersion = 1
+
+// BinaryFormat writes the records and transaction events as length prefixed wire frames
+const BinaryFormat = "binary"
+
+type WireEventType uint8
+
+const (
+	WireRecord  WireEventType = 1
+	WireTxBegin WireEventType = 2
+	WireTxEnd   WireEventType = 3
+)
+
+// WireEvent is a decoded frame. Params holds the record data, the attributes of a
+// transaction begin, or the txStatus of a transaction end
+type WireEvent struct {
+	Type   WireEventType
+	TxID   TxID // tx events only
+	Params map[Param]string
+}
+
+const (
+	wireTimeKey       uint32 = 1
+	wireLevelKey      uint32 = 2
+	wireTxIDKey       uint32 = 3
+	wireLineKey       uint32 = 4
+	wireMessageKey    uint32 = 16
+	wireComponentKey  uint32 = 17
+	wireFileKey       uint32 = 18
+	wireFunctionKey   uint32 = 19
+	wireStackKey      uint32 = 20
+	wireErrorKey      uint32 = 21
+	wireErrorChainKey uint32 = 22
+	wireTxStatusKey   uint32 = 23
+
+	wireCustomKey uint32 = 1 << 31
+
+	// Frames are rejected above this size when reading a stream
+	wireMaxFrameSize = 16 << 20
+)
+
+var wireKeys = map[Param]uint32{
+	TimeParam:       wireTimeKey,
+	LevelParam:      wireLevelKey,
+	TxIDParam:       wireTxIDKey,
+	LineParam:       wireLineKey,
+	MessageParam:    wireMessageKey,
+	ComponentParam:  wireComponentKey,
+	FileParam:       wireFileKey,
+	FunctionParam:   wireFunctionKey,
+	StackParam:      wireStackKey,
+	ErrorParam:      wireErrorKey,
+	ErrorChainParam: wireErrorChainKey,
+	TxStatusParam:   wireTxStatusKey,
+}
+
+var wireParams = func() map[uint32]Param {
+	params := make(map[uint32]Param, len(wireKeys))
+	for param, key := range wireKeys {
+		params[key] = param
+	}
+	return params
+}()
+
+var wireLevels = []LogLevel{Debug, Info, Warn, Error}
+
+var (
+	errWireTruncated = errors.New("wire: truncated frame")
+	errWireTrailing  = errors.New("wire: trailing data after frame")
+)
+
+// AppendWireEvent appends the encoded frame, without the length prefix, to b
+func AppendWireEvent(b []byte, event WireEvent) []byte {
+	b = append(b, WireVersion, byte(event.Type))
+	if event.Type == WireTxBegin || event.Type == WireTxEnd {
+		b = binary.BigEndian.AppendUint64(b, uint64(event.TxID))
+	}
+
+	params := make([]Param, 0, len(event.Params))
+	for param := range event.Params {
+		params = append(params, param)
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i] < params[j] })
+
+	var names []string
+	var attributes []byte
+	for _, param := range params {
+		value := event.Params[param]
+		if key, ok := wireKeys[param]; ok {
+			if fixed, ok := appendWireFixed(nil, key, value); ok {
+				attributes = binary.BigEndian.AppendUint32(attributes, key)
+				attributes = append(attributes, fixed...)
+				continue
+			}
+			if !isWireFixedKey(key) {
+				attributes = binary.BigEndian.AppendUint32(attributes, key)
+				attributes = appendWireString(attributes, value)
+				continue
+			}
+		}
+		attributes = binary.BigEndian.AppendUint32(attributes, wireCustomKey|uint32(len(names)))
+		attributes = appendWireString(attributes, value)
+		names = append(names, string(param))
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(names)))
+	for _, name := range names {
+		b = appendWireString(b, name)
+	}
+	b = binary.AppendUvarint(b, uint64(len(params)))
+	return append(b, attributes...)
+}
+
+func isWireFixedKey(key uint32) bool {
+	return key == wireTimeKey || key == wireLevelKey || key == wireTxIDKey || key == wireLineKey
+}
+
+// appendWireFixed encodes the value of a fixed size key; ok is false when the key isn't fixed
+// size or the value isn't in the canonical form
+func appendWireFixed(b []byte, key uint32, value string) ([]byte, bool) {
+	switch key {
+	case wireTimeKey, wireTxIDKey:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || strconv.FormatInt(v, 10) != value {
+			return b, false
+		}
+		return binary.BigEndian.AppendUint64(b, uint64(v)), true
+	case wireLineKey:
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || strconv.FormatUint(v, 10) != value {
+			return b, false
+		}
+		return binary.BigEndian.AppendUint32(b, uint32(v)), true
+	case wireLevelKey:
+		for i, level := range wireLevels {
+			if string(level) == value {
+				return append(b, byte(i+1)), true
+			}
+		}
+	}
+	return b, false
+}
+
+func appendWireString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// DecodeWireEvent decodes one frame without the length prefix
+func DecodeWireEvent(b []byte) (WireEvent, error) {
+	d := wireDecoder{b: b}
+	var event WireEvent
+
+	version := d.byte()
+	if d.err == nil && version != WireVersion {
+		return event, fmt.Errorf("wire: unsupported version %d", version)
+	}
+	event.Type = WireEventType(d.byte())
+	switch event.Type {
+	case WireRecord:
+	case WireTxBegin, WireTxEnd:
+		event.TxID = TxID(d.uint64())
+	default:
+		if d.err == nil {
+			return event, fmt.Errorf("wire: unknown event type %d", event.Type)
+		}
+	}
+
+	names := make([]string, d.count())
+	for i := range names {
+		names[i] = d.string()
+	}
+
+	count := d.count()
+	event.Params = make(map[Param]string, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		key := d.uint32()
+		if key&wireCustomKey != 0 {
+			index := int(key &^ wireCustomKey)
+			if index >= len(names) {
+				d.fail(fmt.Errorf("wire: string index %d out of range", index))
+				break
+			}
+			event.Params[Param(names[index])] = d.string()
+			continue
+		}
+
+		param, ok := wireParams[key]
+		if !ok {
+			d.fail(fmt.Errorf("wire: unknown key %d", key))
+			break
+		}
+		switch key {
+		case wireTimeKey, wireTxIDKey:
+			event.Params[param] = strconv.FormatInt(int64(d.uint64()), 10)
+		case wireLineKey:
+			event.Params[param] = strconv.FormatUint(uint64(d.uint32()), 10)
+		case wireLevelKey:
+			level := int(d.byte())
+			if d.err != nil {
+				break
+			}
+			if level < 1 || level > len(wireLevels) {
+				d.fail(fmt.Errorf("wire: unknown level %d", level))
+				break
+			}
+			event.Params[param] = string(wireLevels[level-1])
+		default:
+			event.Params[param] = d.string()
+		}
+	}
+
+	if d.err == nil && len(d.b) > 0 {
+		d.err = errWireTrailing
+	}
+	if d.err != nil {
+		return WireEvent{}, d.err
+	}
+	return event, nil
+}
+
+// WriteWireEvent writes the event as a length prefixed frame
+func WriteWireEvent(w io.Writer, event WireEvent) error {
+	_, err := w.Write(wireFrame(event))
+	return err
+}
+
+// ReadWireEvent reads one length prefixed frame; it returns io.EOF at the end of the stream
+func ReadWireEvent(r io.Reader) (WireEvent, error) {
+	var header [4]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return WireEvent{}, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > wireMaxFrameSize {
+		return WireEvent{}, fmt.Errorf("wire: frame of %d bytes exceeds the maximum size", size)
+	}
+	frame := make([]byte, size)
+	_, err = io.ReadFull(r, frame)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return WireEvent{}, err
+	}
+	return DecodeWireEvent(frame)
+}
+
+// wireFrame encodes the event with its length prefix
+func wireFrame(event WireEvent) []byte {
+	frame := AppendWireEvent(make([]byte, 4), event)
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	return frame
+}
+
+// wireDecoder reads the frame fields; after the first error all reads return zero values
+type wireDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *wireDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *wireDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.fail(errWireTruncated)
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *wireDecoder) byte() byte {
+	if v := d.take(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (d *wireDecoder) uint32() uint32 {
+	if v := d.take(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (d *wireDecoder) uint64() uint64 {
+	if v := d.take(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (d *wireDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail(errWireTruncated)
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// count reads an element count; each element takes at least one byte
+func (d *wireDecoder) count() int {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(d.b)) {
+		d.fail(errWireTruncated)
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (d *wireDecoder) string() string {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(d.b)) {
+		d.fail(errWireTruncated)
+	}
+	return string(d.take(int(n)))
+}
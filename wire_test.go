@@ -0,0 +1,163 @@
+package logsystem
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWire_RoundTrip(t *testing.T) {
+	events := []WireEvent{
+		{Type: WireRecord, Params: map[Param]string{
+			MessageParam:   "hello",
+			TimeParam:      "1700000000",
+			LevelParam:     string(Warn),
+			TxIDParam:      "-3",
+			LineParam:      "42",
+			ComponentParam: "auth",
+			FileParam:      "main.go",
+			"UserID":       "123",
+			"":             "empty name",
+		}},
+		{Type: WireRecord, Params: map[Param]string{}},
+		{Type: WireTxBegin, TxID: 7, Params: map[Param]string{"UserID": "123"}},
+		{Type: WireTxEnd, TxID: -1, Params: map[Param]string{TxStatusParam: string(TxFailed)}},
+	}
+	for _, event := range events {
+		decoded, err := DecodeWireEvent(AppendWireEvent(nil, event))
+		require.NoError(t, err)
+		require.Equal(t, event, decoded)
+	}
+}
+
+func TestWire_FixedSizeParams(t *testing.T) {
+	data := map[Param]string{TimeParam: "1700000000", LevelParam: string(Error), LineParam: "12"}
+	// version, type, no strings, 3 attributes: key + 8, key + 1, key + 4
+	require.Len(t, AppendWireEvent(nil, WireEvent{Type: WireRecord, Params: data}), 2+1+1+12+5+8)
+
+	// Values not in the canonical form are sent as application params
+	data = map[Param]string{TimeParam: "007", LevelParam: "verbose", LineParam: "-1", TxIDParam: "x"}
+	frame := AppendWireEvent(nil, WireEvent{Type: WireRecord, Params: data})
+	decoded, err := DecodeWireEvent(frame)
+	require.NoError(t, err)
+	require.Equal(t, data, decoded.Params)
+	require.Contains(t, string(frame), "verbose")
+}
+
+func TestWire_DecodeErrors(t *testing.T) {
+	frame := AppendWireEvent(nil, WireEvent{Type: WireTxBegin, TxID: 1, Params: map[Param]string{"UserID": "1", MessageParam: "m"}})
+	for i := 0; i < len(frame); i++ {
+		_, err := DecodeWireEvent(frame[:i])
+		require.Error(t, err, "truncated at %d", i)
+	}
+
+	_, err := DecodeWireEvent(append(append([]byte{}, frame...), 0))
+	require.ErrorIs(t, err, errWireTrailing)
+
+	_, err = DecodeWireEvent([]byte{2, 1, 0, 0})
+	require.ErrorContains(t, err, "unsupported version 2")
+
+	_, err = DecodeWireEvent([]byte{WireVersion, 9, 0, 0})
+	require.ErrorContains(t, err, "unknown event type 9")
+
+	// A custom key referencing a missing string
+	_, err = DecodeWireEvent([]byte{WireVersion, byte(WireRecord), 0, 1, 0x80, 0, 0, 0, 0})
+	require.ErrorContains(t, err, "string index 0 out of range")
+
+	// Level 5 doesn't exist
+	_, err = DecodeWireEvent([]byte{WireVersion, byte(WireRecord), 0, 1, 0, 0, 0, byte(wireLevelKey), 5})
+	require.ErrorContains(t, err, "unknown level 5")
+}
+
+func TestWire_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	events := []WireEvent{
+		{Type: WireTxBegin, TxID: 1, Params: map[Param]string{}},
+		{Type: WireRecord, Params: map[Param]string{MessageParam: "m", TxIDParam: "1"}},
+		{Type: WireTxEnd, TxID: 1, Params: map[Param]string{}},
+	}
+	for _, event := range events {
+		require.NoError(t, WriteWireEvent(&buf, event))
+	}
+
+	for _, event := range events {
+		decoded, err := ReadWireEvent(&buf)
+		require.NoError(t, err)
+		require.Equal(t, event, decoded)
+	}
+	_, err := ReadWireEvent(&buf)
+	require.ErrorIs(t, err, io.EOF)
+
+	_, err = ReadWireEvent(bytes.NewReader([]byte{0, 0, 0, 9, WireVersion}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestFileDriver_BinaryFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.bin")
+	drv, err := (&FileDriverFactory{}).CreateDriver(json.RawMessage(`{"filePath":"` + path + `","format":"binary"}`))
+	require.NoError(t, err)
+
+	drv.BeginTx(4, map[Param]string{"UserID": "1"})
+	drv.Log(map[Param]string{MessageParam: "inside", TxIDParam: "4", LevelParam: string(Info)})
+	drv.(*FileDriver).EndTxWithStatus(4, TxSucceeded)
+	drv.Stop()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var events []WireEvent
+	for {
+		event, err := ReadWireEvent(file)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+	require.Equal(t, []WireEvent{
+		{Type: WireTxBegin, TxID: 4, Params: map[Param]string{"UserID": "1"}},
+		{Type: WireRecord, Params: map[Param]string{MessageParam: "inside", TxIDParam: "4", LevelParam: string(Info)}},
+		{Type: WireTxEnd, TxID: 4, Params: map[Param]string{TxStatusParam: string(TxSucceeded)}},
+	}, events)
+}
+
+func FuzzWireRoundTrip(f *testing.F) {
+	f.Add("hello", "1700000000", "info", "7", "12", "UserID", "123")
+	f.Add("", "", "", "", "", "", "")
+	f.Add("\x00\xff", "-0", "INFO", "+1", "4294967296", "time", "abc")
+	f.Fuzz(func(t *testing.T, message, timestamp, level, txID, line, name, value string) {
+		event := WireEvent{Type: WireRecord, Params: map[Param]string{
+			MessageParam: message,
+			TimeParam:    timestamp,
+			LevelParam:   level,
+			TxIDParam:    txID,
+			LineParam:    line,
+			Param(name):  value,
+		}}
+		decoded, err := DecodeWireEvent(AppendWireEvent(nil, event))
+		require.NoError(t, err)
+		require.Equal(t, event, decoded)
+	})
+}
+
+func FuzzDecodeWireEvent(f *testing.F) {
+	f.Add(AppendWireEvent(nil, WireEvent{Type: WireRecord, Params: map[Param]string{MessageParam: "m", LevelParam: "info", "k": "v"}}))
+	f.Add(AppendWireEvent(nil, WireEvent{Type: WireTxEnd, TxID: 3, Params: map[Param]string{TxStatusParam: "failed"}}))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		event, err := DecodeWireEvent(frame)
+		if err != nil {
+			return
+		}
+		// Whatever decodes must encode back to an equivalent frame
+		decoded, err := DecodeWireEvent(AppendWireEvent(nil, event))
+		require.NoError(t, err)
+		require.Equal(t, event, decoded)
+	})
+}